@@ -0,0 +1,223 @@
+package doxiego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrMACMismatch the scanner at a cached address is not the one cached
+var ErrMACMismatch = errors.New("doxie: scanner at cached address has a different MAC")
+
+// CacheEntry the last known address of a scanner.
+type CacheEntry struct {
+	// MAC address of the scanner
+	MAC string
+	// Name of the scanner
+	Name string
+	// IP the scanner was last seen at
+	IP string
+	// Port the scanner was last seen on
+	Port int
+	// Seen when the scanner was last seen
+	Seen time.Time
+}
+
+// AddressCache remembers the last known address of scanners, keyed by MAC
+// address, optionally persisting them to a file. It is safe for concurrent
+// use.
+type AddressCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]CacheEntry
+}
+
+// NewAddressCache returns an empty AddressCache held in memory.
+func NewAddressCache() *AddressCache {
+	return &AddressCache{entries: make(map[string]CacheEntry)}
+}
+
+// OpenAddressCache returns an AddressCache persisted to the file at path,
+// loading any entries already saved there. A missing file is not an error, it
+// is created by Save.
+func OpenAddressCache(path string) (*AddressCache, error) {
+	a := NewAddressCache()
+	a.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		a.entries[e.MAC] = e
+	}
+
+	return a, nil
+}
+
+// Save writes the cache to its file, it does nothing for a cache held in
+// memory.
+func (a *AddressCache) Save() error {
+	if a.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(a.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash cannot leave a torn cache
+	tmp, err := ioutil.TempFile(filepath.Dir(a.path), filepath.Base(a.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), a.path)
+}
+
+// Add records the address of the scanner d.
+func (a *AddressCache) Add(d *Doxie) {
+	u, err := url.Parse(d.URL)
+	if err != nil || d.MAC == "" {
+		return
+	}
+
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries[d.MAC] = CacheEntry{
+		MAC:  d.MAC,
+		Name: d.Name,
+		IP:   u.Hostname(),
+		Port: port,
+		Seen: time.Now(),
+	}
+}
+
+// remember records the scanners in doxies and saves the cache. Failing to save
+// is not fatal to discovery, so the error is dropped.
+func (a *AddressCache) remember(doxies ...*Doxie) {
+	for _, d := range doxies {
+		a.Add(d)
+	}
+	a.Save()
+}
+
+// Lookup returns the last known address of the scanner with the MAC address.
+func (a *AddressCache) Lookup(mac string) (CacheEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.entries[mac]
+	return e, ok
+}
+
+// Put records e, replacing any entry for the same MAC address.
+func (a *AddressCache) Put(e CacheEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries[e.MAC] = e
+}
+
+// Remove forgets the scanner with the MAC address.
+func (a *AddressCache) Remove(mac string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.entries, mac)
+}
+
+// Entries returns every cached scanner, most recently seen first.
+func (a *AddressCache) Entries() []CacheEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := make([]CacheEntry, 0, len(a.entries))
+	for _, e := range a.entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seen.After(entries[j].Seen)
+	})
+
+	return entries
+}
+
+// LastKnown returns a Discoverer which tries the last known address of every
+// scanner in cache, and returns those still answering with the cached MAC
+// address.
+func (c *Config) LastKnown(cache *AddressCache) Discoverer {
+	return namedDiscoverer{"last known address", func(ctx context.Context) ([]*Doxie, error) {
+		ds := c.lastKnown(cache)
+		if len(ds) == 0 {
+			return nil, ErrDoxieNotFound
+		}
+
+		return All(ds...).Discover(ctx)
+	}}
+}
+
+// lastKnown a Discoverer for each scanner in cache, which dials its last known
+// address and checks the scanner still has the cached MAC address.
+func (c *Config) lastKnown(cache *AddressCache) []Discoverer {
+	entries := cache.Entries()
+
+	ds := make([]Discoverer, len(entries))
+	for idx, e := range entries {
+		e := e
+		addr := net.JoinHostPort(e.IP, strconv.Itoa(e.Port))
+		ds[idx] = namedDiscoverer{addr, func(ctx context.Context) ([]*Doxie, error) {
+			dox, err := c.Dial(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			if dox.MAC != e.MAC {
+				return nil, ErrMACMismatch
+			}
+			return []*Doxie{dox}, nil
+		}}
+	}
+
+	return ds
+}
@@ -0,0 +1,251 @@
+package doxiego
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupported the scanner model or firmware does not support the request
+var ErrUnsupported = errors.New("doxie: not supported by this scanner")
+
+// Capabilities what a scanner model and firmware supports, used to decide
+// which endpoints, file types and path layouts to use.
+type Capabilities struct {
+	// Model the capabilities apply to e.g. "DX250"
+	Model string
+	// FileTypes content types of the scans saved e.g. "image/jpeg", a scan
+	// named without its folder must be one of them
+	FileTypes []string
+	// Folders the folder scans named with each upper case file extension are
+	// saved in, e.g. ".JPG" in "/DOXIE/JPEG/". A bare name with an extension
+	// not listed is looked for in the ".JPG" folder.
+	Folders map[string]string
+	// UpperCaseNames scan names are upper case, so bare names are too
+	UpperCaseNames bool
+	// Recent scans/recent.json is served
+	Recent bool
+	// Thumbnails thumbnails of scans are served
+	Thumbnails bool
+	// Delete scans/delete.json is served
+	Delete bool
+	// Restart restart.json is served
+	Restart bool
+	// ExternalPower hello_extra.json reports the power source
+	ExternalPower bool
+}
+
+// capabilityEntry the capabilities of a model from a firmware version on.
+type capabilityEntry struct {
+	model    string
+	firmware string
+	caps     Capabilities
+}
+
+// CapabilityTable the capabilities of scanner models and firmware versions. It
+// is safe for concurrent use.
+type CapabilityTable struct {
+	mu      sync.RWMutex
+	entries []capabilityEntry
+}
+
+// dx250 the capabilities of the Doxie Go, which this package was written
+// against, and assumed for models not in the table.
+var dx250 = Capabilities{
+	Model:          "DX250",
+	FileTypes:      []string{"image/jpeg"},
+	Folders:        map[string]string{".JPG": "/DOXIE/JPEG/"},
+	UpperCaseNames: true,
+	Recent:         true,
+	Thumbnails:     true,
+	Delete:         true,
+	Restart:        true,
+	ExternalPower:  true,
+}
+
+// builtinCapabilities the table used by a Doxie without WithCapabilities, it
+// is never modified. Only models checked against a device belong in it.
+var builtinCapabilities = DefaultCapabilities()
+
+// DefaultCapabilities returns a copy of the built-in table, which only knows
+// the DX250, to add or correct entries in and pass to WithCapabilities.
+func DefaultCapabilities() *CapabilityTable {
+	t := &CapabilityTable{}
+	t.Register("DX250", "", dx250)
+	return t
+}
+
+// WithCapabilities makes a Doxie look up what its scanner supports in t rather
+// than the built-in table. Add it to Config.Options to use t for every scanner
+// found with the Config.
+func WithCapabilities(t *CapabilityTable) Option {
+	return func(d *Doxie) {
+		d.capabilities = t
+	}
+}
+
+// Register records the capabilities of model, e.g. "DX250", when running
+// firmware, e.g. "1.29", or any later version until another is registered. An
+// empty firmware applies to every version. A registration for the same model
+// and firmware is replaced.
+func (t *CapabilityTable) Register(model, firmware string, caps Capabilities) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	caps = caps.clone()
+	caps.Model = model
+
+	for idx, e := range t.entries {
+		if e.model == model && e.firmware == firmware {
+			t.entries[idx].caps = caps
+			return
+		}
+	}
+
+	t.entries = append(t.entries, capabilityEntry{model: model, firmware: firmware, caps: caps})
+}
+
+// Lookup returns the capabilities of model running firmware, and false if the
+// model is not in the table.
+func (t *CapabilityTable) Lookup(model, firmware string) (Capabilities, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var best *capabilityEntry
+	for idx, e := range t.entries {
+		if e.model != model || compareVersions(e.firmware, firmware) > 0 {
+			continue
+		}
+		if best == nil || compareVersions(e.firmware, best.firmware) > 0 {
+			best = &t.entries[idx]
+		}
+	}
+
+	if best == nil {
+		return Capabilities{}, false
+	}
+
+	return best.caps.clone(), true
+}
+
+// Capabilities returns what the scanner supports, going by its Model and
+// FirmwareWiFi, from the table given to WithCapabilities or the built-in one.
+// A model which is not in the table is assumed to be like the DX250.
+func (d *Doxie) Capabilities() Capabilities {
+	t := d.capabilities
+	if t == nil {
+		t = builtinCapabilities
+	}
+
+	if caps, ok := t.Lookup(d.Model, d.FirmwareWiFi); ok {
+		return caps
+	}
+
+	caps := dx250.clone()
+	if d.Model != "" {
+		caps.Model = d.Model
+	}
+	return caps
+}
+
+// scanPath the path of a scan on the scanner. A full path, as in
+// ScanItem.Path, is used as given. A bare name is looked for in the folder
+// for its file type, in upper case if the scanner uses upper case names. It
+// returns ErrUnsupported for a bare name of a file type the scanner does not
+// save.
+func (d *Doxie) scanPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		if !strings.HasPrefix(name, "/") {
+			name = "/" + name
+		}
+		return name, nil
+	}
+
+	caps := d.Capabilities()
+
+	if ct := contentTypes[strings.ToLower(path.Ext(name))]; ct != "" && !caps.saves(ct) {
+		return "", fmt.Errorf("%w: %s files", ErrUnsupported, ct)
+	}
+
+	if caps.UpperCaseNames {
+		name = strings.ToUpper(name)
+	}
+
+	folder, ok := caps.Folders[strings.ToUpper(path.Ext(name))]
+	if !ok {
+		folder = caps.Folders[".JPG"]
+	}
+	if folder == "" {
+		folder = doxieInternalPath
+	}
+
+	return folder + name, nil
+}
+
+// saves reports whether the scanner saves scans of contentType.
+func (c Capabilities) saves(contentType string) bool {
+	for _, ct := range c.FileTypes {
+		if ct == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// supports returns ErrUnsupported if ok is false.
+func supports(ok bool, what string) error {
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupported, what)
+	}
+	return nil
+}
+
+// clone returns a copy of c which shares no slices or maps with it.
+func (c Capabilities) clone() Capabilities {
+	c.FileTypes = append([]string(nil), c.FileTypes...)
+
+	folders := make(map[string]string, len(c.Folders))
+	for ext, folder := range c.Folders {
+		folders[ext] = folder
+	}
+	c.Folders = folders
+
+	return c
+}
+
+// compareVersions compares dotted version numbers such as "1.29", returning
+// -1, 0 or 1. An empty version is before every other.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	if a == "" {
+		as = nil
+	}
+	if b == "" {
+		bs = nil
+	}
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		} else {
+			x = -1
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		} else {
+			y = -1
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
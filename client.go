@@ -0,0 +1,176 @@
+package doxiego
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultConnectTimeout time allowed to establish a connection to the scanner
+	DefaultConnectTimeout = 5 * time.Second
+	// DefaultMetadataTimeout time allowed for status, listing and control calls
+	DefaultMetadataTimeout = 5 * time.Second
+	// DefaultDownloadTimeout time allowed to download a single scan or thumbnail
+	DefaultDownloadTimeout = 2 * time.Minute
+	// DefaultDownloadRetries times DownloadFile retries an incomplete download
+	DefaultDownloadRetries = 3
+)
+
+// defaultHTTPClient is shared by every Doxie which has not been given its own
+// client or transport.
+var defaultHTTPClient = &http.Client{Transport: newTransport(DefaultConnectTimeout)}
+
+// Option configures how a Doxie talks to the scanner.
+type Option func(*Doxie)
+
+// WithHTTPClient makes requests through c. The connect timeout and transport
+// options are ignored when a client is supplied.
+func WithHTTPClient(c *http.Client) Option {
+	return func(d *Doxie) {
+		d.httpClient = c
+	}
+}
+
+// WithTransport makes requests through rt. The connect timeout option is
+// ignored when a transport is supplied.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(d *Doxie) {
+		d.transport = rt
+	}
+}
+
+// WithConnectTimeout bounds the time taken to establish a connection.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(d *Doxie) {
+		d.connectTimeout = timeout
+	}
+}
+
+// WithMetadataTimeout bounds status, listing and control calls such as Scans,
+// Recent, Delete and Restart.
+func WithMetadataTimeout(timeout time.Duration) Option {
+	return func(d *Doxie) {
+		d.metadataTimeout = timeout
+	}
+}
+
+// WithDownloadTimeout bounds the download of a single scan or thumbnail.
+func WithDownloadTimeout(timeout time.Duration) Option {
+	return func(d *Doxie) {
+		d.downloadTimeout = timeout
+	}
+}
+
+// WithDownloadRetries sets how many times DownloadFile retries a download
+// which is cut short or fails its checks, zero or less disables retries.
+func WithDownloadRetries(retries int) Option {
+	return func(d *Doxie) {
+		// zero is kept for the default
+		d.downloadRetries = retries
+		if retries <= 0 {
+			d.downloadRetries = -1
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(d *Doxie) {
+		d.userAgent = userAgent
+	}
+}
+
+// WithPassword sets the password used to authenticate with the scanner.
+func WithPassword(password string) Option {
+	return func(d *Doxie) {
+		d.Password = password
+	}
+}
+
+// NewClient returns a Doxie which talks to the scanner at baseURL, for example
+// "http://192.168.1.100:8080/", without searching the network for it. Only URL
+// is populated, use Hello or Dial to fill in the scanners status fields.
+func NewClient(baseURL string, opts ...Option) *Doxie {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	d := &Doxie{URL: baseURL}
+	d.configure(opts...)
+
+	return d
+}
+
+// configure applies opts to d and builds its http client.
+func (d *Doxie) configure(opts ...Option) {
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if d.identity == nil {
+		d.identity = &identityPin{}
+	}
+
+	if d.clock == nil {
+		d.clock = &scannerClock{}
+	}
+
+	if d.httpClient != nil {
+		return
+	}
+
+	if d.transport != nil {
+		d.httpClient = &http.Client{Transport: d.transport}
+	} else if d.connectTimeout > 0 {
+		d.httpClient = &http.Client{Transport: newTransport(d.connectTimeout)}
+	}
+}
+
+// client the http client used to make requests to the scanner.
+func (d *Doxie) client() *http.Client {
+	if d.httpClient != nil {
+		return d.httpClient
+	}
+	return defaultHTTPClient
+}
+
+// timeout returns the configured timeout for download or metadata requests.
+func (d *Doxie) timeout(download bool) time.Duration {
+	if download {
+		if d.downloadTimeout > 0 {
+			return d.downloadTimeout
+		}
+		return DefaultDownloadTimeout
+	}
+	if d.metadataTimeout > 0 {
+		return d.metadataTimeout
+	}
+	return DefaultMetadataTimeout
+}
+
+// retries returns the configured number of download retries.
+func (d *Doxie) retries() int {
+	if d.downloadRetries < 0 {
+		return 0
+	} else if d.downloadRetries == 0 {
+		return DefaultDownloadRetries
+	}
+	return d.downloadRetries
+}
+
+// newTransport returns a transport which gives up connecting after timeout.
+func newTransport(timeout time.Duration) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = (&net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	tr.TLSHandshakeTimeout = timeout
+	return tr
+}
@@ -0,0 +1,90 @@
+package doxiego
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// scanTimeLayout the layout of ScanItem.Modified e.g. "2010-05-01 00:10:06"
+const scanTimeLayout = "2006-01-02 15:04:05"
+
+// ErrNoRecentScan there is no recent scan to estimate the clock drift from
+var ErrNoRecentScan = errors.New("doxie: no recent scan to estimate clock drift from")
+
+// scannerClock the estimated drift of the scanners clock from the host's.
+type scannerClock struct {
+	mu    sync.Mutex
+	drift time.Duration
+}
+
+// WithClockDrift sets the drift of the scanners clock from the host's, for
+// example one saved from an earlier EstimateClockDrift.
+func WithClockDrift(drift time.Duration) Option {
+	return func(d *Doxie) {
+		d.clock = &scannerClock{drift: drift}
+	}
+}
+
+// ClockDrift returns the drift of the scanners clock from the host's, added to
+// ScanItem.ModifiedTime to give ScanItem.Scanned. It is zero until estimated
+// or set.
+func (d *Doxie) ClockDrift() time.Duration {
+	if d.clock == nil {
+		return 0
+	}
+
+	d.clock.mu.Lock()
+	defer d.clock.mu.Unlock()
+
+	return d.clock.drift
+}
+
+// EstimateClockDrift estimates the drift of the scanners clock from the
+// host's, by comparing the modified time of the most recent scan with the time
+// now, and uses it to correct ScanItem.Scanned from then on. It must be called
+// right after a document is scanned, the drift only changes when the scanner
+// is switched off and on.
+func (d *Doxie) EstimateClockDrift(ctx context.Context) (time.Duration, error) {
+	recent, err := d.RecentPathContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if recent == "" {
+		return 0, ErrNoRecentScan
+	}
+
+	items, err := d.ScansContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	for _, i := range items {
+		if i.Path != recent || i.ModifiedTime.IsZero() {
+			continue
+		}
+
+		drift := now.Sub(i.ModifiedTime).Round(time.Second)
+
+		if d.clock != nil {
+			d.clock.mu.Lock()
+			d.clock.drift = drift
+			d.clock.mu.Unlock()
+		}
+
+		return drift, nil
+	}
+
+	return 0, ErrNoRecentScan
+}
+
+// parseScanTime parses the modified time of a scan. The scanner does not
+// know its time zone, the time is read as UTC and the clock drift covers the
+// difference.
+func parseScanTime(s string) (time.Time, error) {
+	return time.ParseInLocation(scanTimeLayout, s, time.UTC)
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"image"
-	"image/jpeg"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/umahmood/doxiego"
 )
@@ -15,15 +17,40 @@ var (
 	help         bool
 	scans        bool
 	hello        bool
+	discover     bool
 	delete       string
 	getScans     bool
 	getThumbanil string
 	getScan      string
 	auth         string
+	addr         string
+	sweep        bool
+	iface        string
+	ipv6         bool
+	noCache      bool
+	syncClock    bool
 )
 
+// modifiers flags which change how the other commands run, and do not count
+// towards them
+var modifiers = map[string]bool{
+	"auth":       true,
+	"addr":       true,
+	"sweep":      true,
+	"iface":      true,
+	"ipv6":       true,
+	"no-cache":   true,
+	"sync-clock": true,
+}
+
 const emptyString = ""
 
+// discoverWindow time spent waiting for scanners to answer -discover
+const discoverWindow = 3 * time.Second
+
+// progressWidth number of characters in a progress bar
+const progressWidth = 20
+
 func init() {
 	flag.Usage = func() {
 		printUsage()
@@ -31,12 +58,19 @@ func init() {
 
 	flag.BoolVar(&help, "help", false, "Print this message and exit")
 	flag.BoolVar(&hello, "hello", false, "Find Doxie Go on Wi-Fi network.")
+	flag.BoolVar(&discover, "discover", false, "List every Doxie on the Wi-Fi network.")
 	flag.BoolVar(&scans, "scans", false, "Display a list of all scans on the scanner.")
 	flag.StringVar(&delete, "delete", emptyString, "Delete scans from the scanner.")
 	flag.BoolVar(&getScans, "get-scans", false, "Download all scans on the scanner.")
 	flag.StringVar(&getThumbanil, "get-thumbnail", emptyString, "Download a thumbnail from the scanner.")
 	flag.StringVar(&getScan, "get-scan", emptyString, "Download a scan from the scanner.")
 	flag.StringVar(&auth, "auth", emptyString, "Password to authenticate with the scanner.")
+	flag.StringVar(&addr, "addr", emptyString, "Connect to the scanner at host:port without searching for it.")
+	flag.BoolVar(&sweep, "sweep", false, "Probe every address on the local subnets if the scanner is not found.")
+	flag.StringVar(&iface, "iface", emptyString, "Search on these network interfaces, comma separated, or 'all'.")
+	flag.BoolVar(&ipv6, "ipv6", false, "Also search using IPv6 link-local multicast.")
+	flag.BoolVar(&noCache, "no-cache", false, "Do not use or update the cache of last known scanner addresses.")
+	flag.BoolVar(&syncClock, "sync-clock", false, "Correct scan times for the scanner's clock, use right after scanning.")
 
 	flag.Parse()
 
@@ -44,7 +78,14 @@ func init() {
 		os.Exit(1)
 	}
 
-	if flag.NFlag() >= 2 && auth == emptyString {
+	commands := 0
+	flag.Visit(func(f *flag.Flag) {
+		if !modifiers[f.Name] {
+			commands++
+		}
+	})
+
+	if commands >= 2 {
 		fmt.Println("to many command line flags, use '-help' for help.")
 		os.Exit(1)
 	}
@@ -56,19 +97,65 @@ func main() {
 		os.Exit(0)
 	}
 
-	doxieGo, err := doxiego.Hello()
+	cfg := doxiego.DefaultConfig()
+	cfg.Sweep = sweep
+	cfg.IPv6 = ipv6
+	if iface == "all" {
+		cfg.AllInterfaces = true
+	} else if iface != emptyString {
+		cfg.Interfaces = splitList(iface)
+	}
+
+	if !noCache {
+		cfg.Cache = openCache()
+	}
+
+	bar := &progressBar{}
+	if getScans {
+		cfg.Options = append(cfg.Options, doxiego.WithProgress(bar.update))
+	}
+
+	if discover {
+		doxies, err := cfg.DiscoverAll(context.Background(), discoverWindow)
+		checkError(err)
+		for _, d := range doxies {
+			fmt.Println("- name:", d.Name, "model:", d.Model, "MAC:", d.MAC, "URL:", d.URL, "interface:", d.Interface)
+		}
+		os.Exit(0)
+	}
+
+	// the scanners seen before this run, Hello adds whichever answers now
+	var known []doxiego.CacheEntry
+	if cfg.Cache != nil {
+		known = cfg.Cache.Entries()
+	}
+
+	var doxieGo *doxiego.Doxie
+	var err error
+	if addr != emptyString {
+		doxieGo, err = cfg.Dial(context.Background(), addr)
+	} else {
+		doxieGo, err = cfg.Hello()
+	}
 	checkError(err)
 
 	if auth != emptyString {
+		checkError(checkIdentity(cfg.Cache, known, doxieGo, addr != emptyString))
 		doxieGo.Password = auth
 	}
 
+	if syncClock {
+		_, err := doxieGo.EstimateClockDrift(context.Background())
+		checkError(err)
+	}
+
 	if hello {
 		fmt.Println("Name:", doxieGo.Name)
 		fmt.Println("Model:", doxieGo.Model)
 		fmt.Println("Has Password:", doxieGo.HasPassword)
 		fmt.Println("Wi-Fi Firmware:", doxieGo.FirmwareWiFi)
 		fmt.Println("MAC:", doxieGo.MAC)
+		fmt.Println("File Types:", strings.Join(doxieGo.Capabilities().FileTypes, ", "))
 		if doxieGo.Mode == "AP" {
 			fmt.Println("Mode:", doxieGo.Mode, "(Doxies own Wi-Fi network)")
 		} else if doxieGo.Mode == "Client" {
@@ -77,25 +164,25 @@ func main() {
 			fmt.Println("IP:", doxieGo.IP)
 		}
 		fmt.Println("URL:", doxieGo.URL)
+		if doxieGo.Interface != emptyString {
+			fmt.Println("Interface:", doxieGo.Interface)
+		}
 	}
 
 	if scans {
 		items, err := doxieGo.Scans()
 		checkError(err)
 		for _, i := range items {
-			fmt.Println("- name:", i.Name, "size:", i.Size, "modified:", i.Modified)
+			if syncClock {
+				fmt.Println("- name:", i.Name, "size:", i.Size, "scanned:", i.Scanned.Local().Format(time.DateTime))
+			} else {
+				fmt.Println("- name:", i.Name, "size:", i.Size, "modified:", i.Modified)
+			}
 		}
 	}
 
 	if delete != emptyString {
-		var dels []string
-		x := strings.Split(delete, ",")
-		for _, d := range x {
-			if d != "" {
-				dels = append(dels, strings.Trim(d, " "))
-			}
-		}
-		_, err := doxieGo.Delete(dels...)
+		_, err := doxieGo.Delete(splitList(delete)...)
 		checkError(err)
 	}
 
@@ -103,38 +190,118 @@ func main() {
 		items, err := doxieGo.Scans()
 		checkError(err)
 		for _, i := range items {
-			img, err := doxieGo.Scan(i.Name)
-			checkError(err)
-			if err := saveImage(img, i.Name); err != nil {
-				fmt.Println("error saving thumbnail", i.Name)
+			bar.total += int64(i.Size)
+		}
+		for _, i := range items {
+			bar.next(int64(i.Size))
+			dl, err := doxieGo.DownloadFile(context.Background(), i, i.Name)
+			bar.finish()
+			if err == nil {
+				err = fixExtension(dl)
+			}
+			if err != nil {
+				fmt.Println("error saving scan", i.Name)
 				fmt.Println(err)
 			} else {
-				fmt.Println("downloaded scan", i.Name)
+				fmt.Println("downloaded scan", dl.Path, "sha256:", dl.SHA256)
+				if syncClock {
+					os.Chtimes(dl.Path, i.Scanned, i.Scanned)
+				}
 			}
 		}
 	}
 
 	if getThumbanil != emptyString {
-		img, err := doxieGo.Thumbnail(getThumbanil)
+		body, info, err := doxieGo.ThumbnailReader(context.Background(), getThumbanil)
 		checkError(err)
-		if err := saveImage(img, getThumbanil); err != nil {
+		fileName := withExtension(getThumbanil, info.ContentType)
+		if err := saveScan(body, fileName); err != nil {
 			fmt.Println("error saving thumbnail", getThumbanil)
 			fmt.Println(err)
 		} else {
-			fmt.Println("downloaded thumbnail", getThumbanil)
+			fmt.Println("downloaded thumbnail", fileName)
 		}
 	}
 
 	if getScan != emptyString {
-		img, err := doxieGo.Scan(getScan)
-		checkError(err)
-		if err := saveImage(img, getScan); err != nil {
+		item := doxiego.ScanItem{Name: getScan}
+		dl, err := doxieGo.DownloadFile(context.Background(), item, filepath.Base(getScan))
+		if err == nil {
+			err = fixExtension(dl)
+		}
+		if err != nil {
 			fmt.Println("error saving scan", getScan)
 			fmt.Println(err)
 		} else {
-			fmt.Println("downloaded scan", getScan)
+			fmt.Println("downloaded scan", dl.Path, "sha256:", dl.SHA256)
+		}
+	}
+}
+
+// openCache opens the cache of last known scanner addresses in the users cache
+// directory, or returns nil if it is unavailable.
+func openCache() *doxiego.AddressCache {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+
+	cache, err := doxiego.OpenAddressCache(filepath.Join(dir, "doxiego", "scanners.json"))
+	if err != nil {
+		return nil
+	}
+
+	return cache
+}
+
+// checkIdentity refuses to send the password to a scanner whose name does not
+// match the one cached for its MAC address or, once a scanner has been cached
+// and unless it was dialled by address, to a scanner not seen before, which may
+// be another host answering the search. Hello has already cached whichever
+// scanner answered, so on refusal the cache is put back as it was and the
+// scanner is not trusted next time either.
+func checkIdentity(cache *doxiego.AddressCache, known []doxiego.CacheEntry, d *doxiego.Doxie, dialled bool) error {
+	if len(known) == 0 {
+		// trust on first use
+		return nil
+	}
+
+	for _, e := range known {
+		if e.MAC != d.MAC {
+			continue
+		}
+		if e.Name == d.Name {
+			return nil
+		}
+		cache.Put(e)
+		cache.Save()
+		return &doxiego.IdentityError{
+			URL:    d.URL,
+			Pinned: doxiego.Identity{MAC: e.MAC, Name: e.Name},
+			Got:    doxiego.Identity{MAC: d.MAC, Name: d.Name},
 		}
 	}
+
+	if dialled {
+		return nil
+	}
+
+	cache.Remove(d.MAC)
+	cache.Save()
+
+	return fmt.Errorf("%w: %s (%s) at %s has not been seen before, run doxiego -hello without -auth to trust it",
+		doxiego.ErrIdentityMismatch, d.Name, d.MAC, d.URL)
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item != "" {
+			items = append(items, strings.Trim(item, " "))
+		}
+	}
+	return items
 }
 
 func checkError(err error) {
@@ -144,24 +311,111 @@ func checkError(err error) {
 	}
 }
 
-func saveImage(img image.Image, fileName string) error {
+// saveScan writes the scan or thumbnail read from body to fileName unchanged,
+// keeping its original quality and metadata.
+func saveScan(body io.ReadCloser, fileName string) error {
+	defer body.Close()
+
 	file, err := os.Create(fileName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	err = jpeg.Encode(file, img, nil)
-	if err != nil {
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
 		return err
 	}
+
+	return file.Close()
+}
+
+// fixExtension renames the downloaded scan to have the extension for its
+// content type, such as ".pdf" for a PDF.
+func fixExtension(dl *doxiego.Download) error {
+	fileName := withExtension(dl.Path, dl.ContentType)
+	if fileName == dl.Path {
+		return nil
+	}
+
+	if err := os.Rename(dl.Path, fileName); err != nil {
+		return err
+	}
+
+	dl.Path = fileName
 	return nil
 }
 
+// withExtension returns fileName with the extension for contentType, unless
+// it already has it or the content type is not known.
+func withExtension(fileName, contentType string) string {
+	ext := doxiego.Extension(contentType)
+	have := strings.ToLower(filepath.Ext(fileName))
+
+	if ext == "" || have == ext || (ext == ".jpg" && have == ".jpeg") {
+		return fileName
+	}
+
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ext
+}
+
+// progressBar renders the progress of each scan downloaded by -get-scans, and
+// of all of them, on stderr.
+type progressBar struct {
+	// size ScanItem.Size of the scan being downloaded
+	size int64
+	// received bytes of the scan being downloaded
+	received int64
+	// done bytes of the scans already downloaded
+	done int64
+	// total ScanItem.Size of every scan
+	total int64
+}
+
+// update redraws the bar with the progress of the scan being downloaded.
+func (b *progressBar) update(p doxiego.Progress) {
+	size := p.Total
+	if size < 0 {
+		size = b.size
+	}
+	b.received = p.Received
+	fmt.Fprintf(os.Stderr, "\r%s %s  total %s", p.Name, renderBar(p.Received, size), renderBar(b.done+p.Received, b.total))
+}
+
+// next starts the bar for a scan of size bytes.
+func (b *progressBar) next(size int64) {
+	b.size = size
+	b.received = 0
+}
+
+// finish ends the bar of the scan being downloaded.
+func (b *progressBar) finish() {
+	if b.received > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	b.done += b.received
+}
+
+// renderBar draws a bar n bytes of total full, or a byte count if the total
+// is unknown.
+func renderBar(n, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+
+	percent := n * 100 / total
+	if percent > 100 {
+		percent = 100
+	}
+
+	filled := int(percent) * progressWidth / 100
+
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled), percent)
+}
+
 func printUsage() {
-	fmt.Println(banner)
-	fmt.Println(usage)
-	fmt.Println(examples)
+	fmt.Print(banner, "\n")
+	fmt.Print(usage, "\n")
+	fmt.Print(examples, "\n")
 }
 
 const banner = `
@@ -175,11 +429,19 @@ const usage = `usage:
 
     -help           - Print this message and exit.
     -hello          - Find Doxie Go on Wi-Fi network.
+    -discover       - List every Doxie on the Wi-Fi network.
     -scans          - Display a list of all scans on the scanner.
     -delete         - Delete scans from the scanner.
     -get-scans      - Download all scans on the scanner.
     -get-thumbnail  - Download a scan as a thumbnail from the scanner.
     -get-scan       - Download a scan from the scanner.
+    -auth           - Password to authenticate with the scanner.
+    -addr           - Connect to the scanner at host:port without searching for it.
+    -sweep          - Probe every address on the local subnets if the scanner is not found.
+    -iface          - Search on these network interfaces, comma separated, or 'all'.
+    -ipv6           - Also search using IPv6 link-local multicast.
+    -no-cache       - Do not use or update the cache of last known scanner addresses.
+    -sync-clock     - Correct scan times for the scanner's clock, use right after scanning.
 `
 
 const examples = `example usage:
@@ -188,6 +450,10 @@ Find Doxie on the network:
 
 $ doxiego -hello
 
+List every Doxie on the network:
+
+$ doxiego -discover
+
 Display a list of all scans:
 
 $ doxiego -scans
@@ -207,4 +473,20 @@ $ doxiego -get-scan img_019.jpg
 Download all scans:
 
 $ doxiego -get-scans
+
+Connect to a scanner at a known address:
+
+$ doxiego -addr 192.168.0.18:8080 -scans
+
+Find a scanner on a network which blocks multicast:
+
+$ doxiego -sweep -hello
+
+Find a scanner on a particular network interface:
+
+$ doxiego -iface en0 -hello
+
+Download all scans right after scanning, with the time they were scanned:
+
+$ doxiego -sync-clock -get-scans
 `
@@ -0,0 +1,235 @@
+package doxiego
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAPModeIP ip of scanner when it creates its own network
+	DefaultAPModeIP = "192.168.1.100"
+	// DefaultPort default port of the doxie scanner
+	DefaultPort = 8080
+	// DefaultSearchWindow time Hello waits for an answer to its SSDP search
+	DefaultSearchWindow = 3 * time.Second
+)
+
+// Config holds the settings used to find and connect to a scanner. Unlike the
+// deprecated package level variables, each Config is independent, and a Config
+// may be used by several goroutines at once as long as it is not modified.
+type Config struct {
+	// APModeIP ip of scanner when it creates its own network, defaults to
+	// DefaultAPModeIP
+	APModeIP string
+	// StaticIP of the scanner when it joins client network, if set the
+	// scanner is always contacted at this address
+	StaticIP string
+	// Port of the doxie scanner, defaults to DefaultPort
+	Port int
+	// SSDPAddr address SSDP searches are sent to, defaults to DefaultSSDPAddr
+	SSDPAddr string
+	// SSDPAddr6 address IPv6 SSDP searches are sent to, defaults to
+	// DefaultSSDPAddr6
+	SSDPAddr6 string
+	// Interfaces names of the network interfaces SSDP searches are sent on.
+	// If empty, and AllInterfaces and IPv6 are false, the kernel picks one.
+	// Monitor does not use it, nor AllInterfaces or IPv6.
+	Interfaces []string
+	// AllInterfaces sends SSDP searches on every up multicast interface
+	AllInterfaces bool
+	// IPv6 also sends SSDP searches to the IPv6 link-local group on each
+	// interface, on every interface if none are named
+	IPv6 bool
+	// SearchWindow time Hello waits for an answer to its SSDP search, defaults
+	// to DefaultSearchWindow
+	SearchWindow time.Duration
+	// Options applied to every Doxie found using this Config
+	Options []Option
+	// Discoverer used by Hello to find the scanner, defaults to searching in
+	// AP mode and using SSDP in parallel, or only StaticIP if it is set
+	Discoverer Discoverer
+	// Sweep makes the default Discoverer fall back to a subnet sweep when AP
+	// mode and SSDP searches fail, for networks which filter SSDP
+	Sweep bool
+	// SweepConcurrency number of hosts probed at once by a subnet sweep,
+	// defaults to DefaultSweepConcurrency
+	SweepConcurrency int
+	// SweepTimeout time a host has to answer a subnet sweep probe, defaults
+	// to DefaultSweepTimeout
+	SweepTimeout time.Duration
+	// Rediscover makes every Doxie found using this Config search for its
+	// scanner again when it cannot be reached, see WithRediscovery
+	Rediscover bool
+	// Cache if set is tried by Hello alongside its search, the first cached
+	// address answering with the cached MAC address wins, and records every
+	// scanner found by Hello and DiscoverAll
+	Cache *AddressCache
+}
+
+// DefaultConfig returns a Config populated from the package level APModeIP,
+// StaticIP and Port variables.
+func DefaultConfig() *Config {
+	return &Config{
+		APModeIP: APModeIP,
+		StaticIP: StaticIP,
+		Port:     Port,
+	}
+}
+
+// Dial connects to the scanner at addr, in the form "host:port" or "host", or
+// a URL such as "https://host:port/", and returns its status as Hello does,
+// without searching the network for it. If the port is omitted DefaultPort is
+// used. Options, such as WithPassword, are applied to the returned Doxie.
+func Dial(ctx context.Context, addr string, opts ...Option) (*Doxie, error) {
+	return (&Config{Options: opts}).Dial(ctx, addr)
+}
+
+// Hello is like the package level Hello but uses the settings in c.
+func (c *Config) Hello() (*Doxie, error) {
+	return c.HelloContext(context.Background())
+}
+
+// HelloContext is like the package level HelloContext but uses the settings
+// in c.
+func (c *Config) HelloContext(ctx context.Context) (*Doxie, error) {
+	d := c.discoverer()
+	if c.Cache != nil {
+		// every cached address races the search on its own, so a stale entry
+		// does not hold up the others
+		d = FirstOf(append(c.lastKnown(c.Cache), namedDiscoverer{"search", d.Discover})...)
+	}
+
+	doxies, err := d.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doxies) == 0 {
+		return nil, ErrDoxieNotFound
+	}
+
+	if c.Cache != nil {
+		c.Cache.remember(doxies[0])
+	}
+
+	return doxies[0], nil
+}
+
+// Dial is like the package level Dial but uses the port and options in c.
+func (c *Config) Dial(ctx context.Context, addr string) (*Doxie, error) {
+	scheme := "http"
+
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		scheme, addr = u.Scheme, u.Host
+	} else {
+		addr = strings.TrimSuffix(addr, "/")
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// a bare IPv6 address may be bracketed, JoinHostPort adds them back
+		host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		addr = net.JoinHostPort(host, strconv.Itoa(c.port()))
+	}
+
+	return hello(ctx, scheme+"://"+addr+"/", c.options()...)
+}
+
+// discoverer the Discoverer used by Hello.
+func (c *Config) discoverer() Discoverer {
+	if c.Discoverer != nil {
+		return c.Discoverer
+	}
+
+	if c.StaticIP != "" {
+		return c.Static(c.StaticIP)
+	}
+
+	// Find Doxie on the network it creates - 'AP' mode, and on the network it
+	// joins - 'Client' mode
+	search := FirstOf(c.APMode(), c.SSDP(c.searchWindow()))
+
+	if c.Sweep {
+		return InOrder(namedDiscoverer{"search", search.Discover}, c.SubnetSweep())
+	}
+
+	return search
+}
+
+// hello requests hello.json from the scanner at url.
+func hello(ctx context.Context, url string, opts ...Option) (*Doxie, error) {
+	dox := NewClient(url, opts...)
+
+	r := dox.httpGetRequest(ctx, "hello.json", false)
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.statusCode != http.StatusOK {
+		return nil, r.httpError()
+	}
+
+	// decode into a separate value so the scanner cannot overwrite client
+	// side fields such as the URL or password
+	var status Doxie
+
+	err := decodeLenient(r.data, &status, helloFields)
+	if err != nil {
+		return nil, err
+	}
+
+	dox.HasPassword = status.HasPassword
+	dox.Model = status.Model
+	dox.Name = status.Name
+	dox.FirmwareWiFi = status.FirmwareWiFi
+	dox.MAC = status.MAC
+	dox.Mode = status.Mode
+	dox.Network = status.Network
+	dox.IP = status.IP
+	dox.Extra = status.Extra
+	dox.URL = url
+
+	// trust on first use, a mismatch is only reported when the password
+	// would be sent
+	dox.identity.pin(dox.URL, Identity{MAC: dox.MAC, Name: dox.Name})
+
+	return dox, nil
+}
+
+// baseURL the URL of the scanner API at ip.
+func (c *Config) baseURL(ip string) string {
+	return "http://" + net.JoinHostPort(ip, strconv.Itoa(c.port())) + "/"
+}
+
+// apModeIP ip of the scanner in AP mode.
+func (c *Config) apModeIP() string {
+	if c.APModeIP != "" {
+		return c.APModeIP
+	}
+	return DefaultAPModeIP
+}
+
+// searchWindow time Hello waits for an answer to its SSDP search.
+func (c *Config) searchWindow() time.Duration {
+	if c.SearchWindow > 0 {
+		return c.SearchWindow
+	}
+	return DefaultSearchWindow
+}
+
+// port of the scanner.
+func (c *Config) port() int {
+	if c.Port > 0 {
+		return c.Port
+	}
+	return DefaultPort
+}
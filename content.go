@@ -0,0 +1,111 @@
+package doxiego
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen bytes of a scan used to detect its content type
+const sniffLen = 512
+
+// ErrNotImage the scan is a document, such as a PDF, rather than an image,
+// use ScanDocument to fetch it
+var ErrNotImage = errors.New("doxie: scan is not an image")
+
+// extensions the file extension of each content type a scanner saves.
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// contentTypes the content type of each file extension a scanner saves.
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".pdf":  "application/pdf",
+}
+
+// Document a scan returned as stored on the scanner, without decoding, such
+// as a PDF.
+type Document struct {
+	// Name of the scan e.g. "DOC_0001.PDF"
+	Name string
+	// ContentType of the scan e.g. "application/pdf"
+	ContentType string
+	// Data the bytes of the scan
+	Data []byte
+}
+
+// Ext returns the file extension for the document, see Extension.
+func (doc *Document) Ext() string {
+	if ext := Extension(doc.ContentType); ext != "" {
+		return ext
+	}
+	return path.Ext(doc.Name)
+}
+
+// Extension returns the file extension, e.g. ".pdf", for a scan of
+// contentType, or an empty string if it is not known.
+func Extension(contentType string) string {
+	return extensions[mediaType(contentType)]
+}
+
+// ScanDocument gets a scan by its path, as in ScanItem.Path, or by name,
+// without decoding it. Use it for scans which are not images, such as PDFs.
+func (d *Doxie) ScanDocument(ctx context.Context, name string) (*Document, error) {
+	body, info, err := d.ScanReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{Name: info.Name, ContentType: info.ContentType, Data: data}, nil
+}
+
+// sniffedBody the body of a scan read through the buffer used to detect its
+// content type.
+type sniffedBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// sniff detects the content type of the scan in body from its magic bytes,
+// falling back to the Content-Type header, and returns a reader for the whole
+// body.
+func sniff(body io.ReadCloser, header string) (io.ReadCloser, string) {
+	r := bufio.NewReaderSize(body, sniffLen)
+
+	head, _ := r.Peek(sniffLen)
+	detected := mediaType(http.DetectContentType(head))
+
+	// DetectContentType falls back to these when it does not recognise the
+	// bytes
+	if detected == "application/octet-stream" || strings.HasPrefix(detected, "text/") {
+		if header != "" {
+			detected = mediaType(header)
+		}
+	}
+
+	return &sniffedBody{Reader: r, Closer: body}, detected
+}
+
+// mediaType contentType without parameters such as charset.
+func mediaType(contentType string) string {
+	if idx := strings.Index(contentType, ";"); idx >= 0 {
+		contentType = contentType[:idx]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
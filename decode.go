@@ -0,0 +1,149 @@
+package doxiego
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// extraField the name of the field unrecognised JSON fields are kept in
+const extraField = "Extra"
+
+// the fields the scanner reports in each endpoint, the remaining fields are set
+// by the client and are never taken from the scanner
+var (
+	helloFields      = []string{"HasPassword", "Model", "Name", "FirmwareWiFi", "MAC", "Mode", "Network", "IP"}
+	identityFields   = []string{"MAC", "Name"}
+	scanItemFields   = []string{"Name", "Size", "Modified"}
+	helloExtraFields = []string{"Firmware", "ConnectedToExternalPower"}
+)
+
+// decodeScans decodes scans.json leniently, see decodeLenient.
+func decodeScans(data []byte) ([]ScanItem, error) {
+	var objects []json.RawMessage
+
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	items := make([]ScanItem, len(objects))
+	for idx, object := range objects {
+		if err := decodeLenient(object, &items[idx], scanItemFields); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// decodeLenient decodes the JSON object in data, from one of the scanner
+// endpoints, into the named fields of the struct v points to, matching field
+// names without regard to case as encoding/json does. It tolerates the type
+// variations seen between firmware versions: strings, numbers and booleans are
+// converted to the type of the field where the value allows. Fields which are
+// not named, or whose value cannot be converted, are kept in the Extra field of
+// v, if it has one, rather than failing.
+func decodeLenient(data []byte, v interface{}, names []string) error {
+	var object map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	fields := make(map[string]int)
+	for _, name := range names {
+		if f, ok := rt.FieldByName(name); ok {
+			fields[strings.ToLower(name)] = f.Index[0]
+		}
+	}
+
+	extra := make(map[string]json.RawMessage)
+
+	for key, raw := range object {
+		idx, ok := fields[strings.ToLower(key)]
+		if !ok || !setLenient(rv.Field(idx), raw) {
+			extra[key] = raw
+		}
+	}
+
+	if len(extra) == 0 {
+		extra = nil
+	}
+
+	if f := rv.FieldByName(extraField); f.IsValid() {
+		f.Set(reflect.ValueOf(extra))
+	}
+
+	return nil
+}
+
+// setLenient sets field to the JSON value raw, converting between strings,
+// numbers and booleans. It reports false if the value cannot be converted.
+func setLenient(field reflect.Value, raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+
+	if string(raw) == "null" {
+		return true
+	}
+
+	// the value as text, unquoted if it is a string
+	text := string(raw)
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return false
+		}
+	}
+	text = strings.TrimSpace(text)
+
+	switch field.Kind() {
+	case reflect.String:
+		if len(raw) > 0 && (raw[0] == '{' || raw[0] == '[') {
+			return false
+		}
+		field.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return false
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(text, 64)
+			if ferr != nil {
+				return false
+			}
+			n = int64(f)
+		}
+		if field.OverflowInt(n) {
+			return false
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, 64)
+		if err != nil || field.OverflowUint(n) {
+			return false
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return false
+		}
+		field.SetFloat(f)
+	default:
+		ptr := reflect.New(field.Type())
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return false
+		}
+		field.Set(ptr.Elem())
+	}
+
+	return true
+}
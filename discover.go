@@ -0,0 +1,235 @@
+package doxiego
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Discoverer finds scanners on the network. Implementations must honour the
+// cancellation of ctx, and return an error rather than an empty slice when no
+// scanner is found.
+type Discoverer interface {
+	Discover(ctx context.Context) ([]*Doxie, error)
+}
+
+// DiscovererFunc adapts a function to a Discoverer.
+type DiscovererFunc func(ctx context.Context) ([]*Doxie, error)
+
+// Discover calls f(ctx).
+func (f DiscovererFunc) Discover(ctx context.Context) ([]*Doxie, error) {
+	return f(ctx)
+}
+
+// namedDiscoverer a Discoverer with a name used in error messages.
+type namedDiscoverer struct {
+	name string
+	DiscovererFunc
+}
+
+func (d namedDiscoverer) String() string {
+	return d.name
+}
+
+// discovererName the name of d used in error messages.
+func discovererName(d Discoverer) string {
+	if s, ok := d.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// discover runs d, treating an empty result as ErrDoxieNotFound.
+func discover(ctx context.Context, d Discoverer) ([]*Doxie, error) {
+	doxies, err := d.Discover(ctx)
+	if err == nil && len(doxies) == 0 {
+		err = ErrDoxieNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", discovererName(d), err)
+	}
+	return doxies, nil
+}
+
+// FirstOf runs every discoverer in parallel and returns the scanners found by
+// the first to succeed, cancelling the rest. If every discoverer fails a
+// *DiscoveryError with the reasons is returned.
+func FirstOf(ds ...Discoverer) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]*Doxie, error) {
+		type result struct {
+			idx    int
+			doxies []*Doxie
+			err    error
+		}
+
+		// cancelling ctx on return stops whichever search is still running,
+		// the buffered channel lets it finish without a receiver.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make(chan result, len(ds))
+
+		for idx, d := range ds {
+			go func(idx int, d Discoverer) {
+				doxies, err := discover(ctx, d)
+				results <- result{idx: idx, doxies: doxies, err: err}
+			}(idx, d)
+		}
+
+		errs := make([]error, len(ds))
+
+		for range ds {
+			r := <-results
+			if r.err == nil {
+				return r.doxies, nil
+			}
+			errs[r.idx] = r.err
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, &DiscoveryError{Errs: errs}
+	})
+}
+
+// InOrder runs each discoverer in turn and returns the scanners found by the
+// first to succeed. If every discoverer fails a *DiscoveryError with the
+// reasons is returned.
+func InOrder(ds ...Discoverer) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]*Doxie, error) {
+		var errs []error
+
+		for _, d := range ds {
+			doxies, err := discover(ctx, d)
+			if err == nil {
+				return doxies, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, err)
+		}
+
+		return nil, &DiscoveryError{Errs: errs}
+	})
+}
+
+// All runs every discoverer in parallel and returns all the scanners found,
+// de-duplicated by MAC address. It only fails, with a *DiscoveryError, if
+// every discoverer fails.
+func All(ds ...Discoverer) Discoverer {
+	return DiscovererFunc(func(ctx context.Context) ([]*Doxie, error) {
+		found := make([][]*Doxie, len(ds))
+		errs := make([]error, len(ds))
+
+		var wg sync.WaitGroup
+		for idx, d := range ds {
+			wg.Add(1)
+			go func(idx int, d Discoverer) {
+				defer wg.Done()
+				found[idx], errs[idx] = discover(ctx, d)
+			}(idx, d)
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var doxies []*Doxie
+		for _, f := range found {
+			doxies = append(doxies, f...)
+		}
+
+		if len(doxies) == 0 {
+			return nil, &DiscoveryError{Errs: errs}
+		}
+
+		return uniqueByMAC(doxies), nil
+	})
+}
+
+// APMode returns a Discoverer which finds the scanner on the network it
+// creates, at Config.APModeIP.
+func (c *Config) APMode() Discoverer {
+	return namedDiscoverer{"AP mode", func(ctx context.Context) ([]*Doxie, error) {
+		dox, err := hello(ctx, c.baseURL(c.apModeIP()), c.options()...)
+		if err != nil {
+			return nil, err
+		}
+		return []*Doxie{dox}, nil
+	}}
+}
+
+// SSDP returns a Discoverer which finds the first scanner to answer an SSDP
+// search within window, on the network the scanner has joined.
+func (c *Config) SSDP(window time.Duration) Discoverer {
+	return namedDiscoverer{"SSDP", func(ctx context.Context) ([]*Doxie, error) {
+		searchCtx, cancel := context.WithTimeout(ctx, window)
+		defer cancel()
+
+		var found *ssdpResponse
+
+		err := c.ssdpSearch(searchCtx, func(r *ssdpResponse) bool {
+			found = r
+			return false
+		})
+		if err != nil {
+			if ctx.Err() == nil && searchCtx.Err() == context.DeadlineExceeded {
+				return nil, fmt.Errorf("no response within %s: %w", window, ErrTimeout)
+			}
+			return nil, err
+		}
+
+		dox, err := c.helloResponder(ctx, found)
+		if err != nil {
+			return nil, err
+		}
+		return []*Doxie{dox}, nil
+	}}
+}
+
+// SSDPAll returns a Discoverer which finds every scanner answering an SSDP
+// search within window, as DiscoverAll does.
+func (c *Config) SSDPAll(window time.Duration) Discoverer {
+	return namedDiscoverer{"SSDP", func(ctx context.Context) ([]*Doxie, error) {
+		return c.DiscoverAll(ctx, window)
+	}}
+}
+
+// Static returns a Discoverer which connects to each of addrs, in the form
+// "host:port" or "host", and returns every scanner which answers.
+func (c *Config) Static(addrs ...string) Discoverer {
+	ds := make([]Discoverer, len(addrs))
+	for idx, addr := range addrs {
+		addr := addr
+		ds[idx] = namedDiscoverer{addr, func(ctx context.Context) ([]*Doxie, error) {
+			dox, err := c.Dial(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			return []*Doxie{dox}, nil
+		}}
+	}
+	return namedDiscoverer{"static", All(ds...).Discover}
+}
+
+// uniqueByMAC returns doxies without repeats of the same MAC address, keeping
+// the first of each.
+func uniqueByMAC(doxies []*Doxie) []*Doxie {
+	var unique []*Doxie
+	macs := make(map[string]bool)
+
+	for _, dox := range doxies {
+		if dox == nil || macs[dox.MAC] {
+			continue
+		}
+		macs[dox.MAC] = true
+		unique = append(unique, dox)
+	}
+
+	return unique
+}
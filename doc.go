@@ -7,6 +7,7 @@ scanner.
     package main
 
     import (
+        "context"
         "fmt"
 
         "github.com/umahmood/doxiego"
@@ -33,14 +34,12 @@ scanner.
             fmt.Println("name:", s.Name, "size:", s.Size, "modified:", s.Modified)
         }
 
-        // download a scan
-        img, err := doxieGo.Scan("img_0001.jpg")
+        // download a scan, unchanged from the copy on the scanner
+        _, err = doxieGo.DownloadTo(context.Background(), "img_0001.jpg", file)
         if err != nil {
             //...
         }
 
-        jpeg.Encode(file, img, nil)
-
         // delete scans off the scanner
         ok, err := doxieGo.Delete("img_0001.jpg", "img_0002.jpg")
         if err != nil {
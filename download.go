@@ -0,0 +1,424 @@
+package doxiego
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// partSuffix added to the name of a file while DownloadFile writes it
+	partSuffix = ".part"
+	// downloadRetryDelay how long DownloadFile waits before its first retry,
+	// each later retry waits a multiple of it
+	downloadRetryDelay = 250 * time.Millisecond
+)
+
+var (
+	// jpegSOI marker a JPEG starts with
+	jpegSOI = []byte{0xff, 0xd8}
+	// jpegEOI marker a JPEG ends with
+	jpegEOI = []byte{0xff, 0xd9}
+)
+
+// ScanInfo describes a scan or thumbnail being downloaded.
+type ScanInfo struct {
+	// Name of the scan e.g. "IMG_0001.JPG"
+	Name string
+	// Size of the whole scan in bytes, -1 if the scanner did not say
+	Size int64
+	// ContentType of the scan e.g. "image/jpeg", detected from its first bytes
+	// or, if they are not recognised or the download is resumed, as reported
+	// by the scanner
+	ContentType string
+	// Offset of the first byte read, non-zero when a download is resumed
+	Offset int64
+}
+
+// Progress of a scan or thumbnail download.
+type Progress struct {
+	// Name of the scan e.g. "IMG_0001.JPG"
+	Name string
+	// Received bytes so far
+	Received int64
+	// Total size of the download in bytes, -1 if the scanner did not say, in
+	// which case ScanItem.Size can be used instead
+	Total int64
+}
+
+// WithProgress calls fn as each part of a scan or thumbnail download is
+// received. fn is called from the goroutine reading the download.
+func WithProgress(fn func(Progress)) Option {
+	return func(d *Doxie) {
+		d.progress = fn
+	}
+}
+
+// ScanReader opens a scan by its path, as in ScanItem.Path, or by name,
+// returning its bytes exactly as stored on the scanner. The caller must close
+// the reader. Reading is bound by the download timeout.
+func (d *Doxie) ScanReader(ctx context.Context, name string) (io.ReadCloser, *ScanInfo, error) {
+	return d.openScan(ctx, "scans", name, 0)
+}
+
+// ThumbnailReader is like ScanReader but opens the thumbnail of the scan.
+// Returns error ErrNoThumbnail if the thumbnail has not yet been generated.
+func (d *Doxie) ThumbnailReader(ctx context.Context, name string) (io.ReadCloser, *ScanInfo, error) {
+	body, info, err := d.openScan(ctx, "thumbnails", name, 0)
+	if errors.Is(err, ErrScanNotFound) {
+		return nil, nil, ErrNoThumbnail
+	}
+	return body, info, err
+}
+
+// Download a scan saved by DownloadFile.
+type Download struct {
+	// Path of the saved scan
+	Path string
+	// Size of the scan in bytes
+	Size int64
+	// SHA256 checksum of the scan, hex encoded
+	SHA256 string
+	// ContentType of the scan e.g. "image/jpeg", see ScanInfo.ContentType
+	ContentType string
+}
+
+// DownloadTo writes a scan by name to w, unchanged, and returns the number of
+// bytes written. It fails with ErrIncompleteDownload if fewer bytes than the
+// scanner said were received, or a JPEG lacks its end of image marker.
+func (d *Doxie) DownloadTo(ctx context.Context, name string, w io.Writer) (int64, error) {
+	body, info, err := d.ScanReader(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	var check scanCheck
+
+	n, err := io.Copy(io.MultiWriter(w, &check), body)
+	if err != nil {
+		return n, err
+	}
+
+	if n == 0 {
+		return 0, ErrDownloadingScan
+	}
+
+	return n, check.verify(info.Name, info.Size, isJPEG(info))
+}
+
+// DownloadFile downloads a scan to the file at path, unchanged. The scan is
+// written to path plus ".part" first. If that exists from an interrupted
+// download it is resumed with a Range request, or restarted if the scanner
+// does not honour the range. The part file is then checked: its length
+// against item.Size when known, and the start and end markers of a JPEG. A
+// download which is cut short or fails the checks is retried, see
+// WithDownloadRetries, and once they are exhausted fails with
+// ErrIncompleteDownload. A verified part file is renamed to path.
+func (d *Doxie) DownloadFile(ctx context.Context, item ScanItem, path string) (*Download, error) {
+	part := path + partSuffix
+
+	attempts := d.retries() + 1
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * downloadRetryDelay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		var dl *Download
+		dl, err = d.downloadPart(ctx, item, part)
+		if err == nil {
+			if err := os.Rename(part, path); err != nil {
+				return nil, err
+			}
+			dl.Path = path
+			return dl, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var netErr *NetError
+		switch {
+		case errors.Is(err, ErrCorruptScan):
+			// start again rather than resume a corrupt part file
+			os.Remove(part)
+		case errors.Is(err, ErrIncompleteDownload), errors.As(err, &netErr):
+		default:
+			return nil, err
+		}
+	}
+
+	if errors.Is(err, ErrIncompleteDownload) {
+		return nil, fmt.Errorf("%w, after %d attempts", err, attempts)
+	}
+	return nil, fmt.Errorf("%w after %d attempts: %w", ErrIncompleteDownload, attempts, err)
+}
+
+// downloadPart downloads, or resumes downloading, a scan to the file part and
+// verifies it.
+func (d *Doxie) downloadPart(ctx context.Context, item ScanItem, part string) (*Download, error) {
+	file, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	name := item.Path
+	if name == "" {
+		name = item.Name
+	}
+
+	body, info, err := d.openScan(ctx, "scans", name, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	// the scanner sent the whole scan, start the part file again
+	if info.Offset != offset {
+		if err := file.Truncate(0); err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.Copy(file, body); err != nil {
+		return nil, err
+	}
+
+	// check and checksum the whole file, including any part resumed from
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var check scanCheck
+	sum := sha256.New()
+
+	if _, err := io.Copy(io.MultiWriter(sum, &check), file); err != nil {
+		return nil, err
+	}
+
+	want := info.Size
+	if item.Size > 0 {
+		want = int64(item.Size)
+	}
+
+	if err := check.verify(info.Name, want, isJPEG(info)); err != nil {
+		return nil, err
+	}
+
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Download{Size: check.size, SHA256: hex.EncodeToString(sum.Sum(nil)), ContentType: info.ContentType}, nil
+}
+
+// openScan opens the scan or thumbnail by name, kind being "scans" or
+// "thumbnails", from byte offset if the scanner honours a Range request. The
+// ScanInfo says which byte the body starts at.
+func (d *Doxie) openScan(ctx context.Context, kind, name string, offset int64) (io.ReadCloser, *ScanInfo, error) {
+	if kind == "thumbnails" {
+		if err := supports(d.Capabilities().Thumbnails, "thumbnails"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	scan, err := d.scanPath(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	endpoint := kind + scan
+
+	var header http.Header
+	if offset > 0 {
+		header = http.Header{"Range": {"bytes=" + strconv.FormatInt(offset, 10) + "-"}}
+	}
+
+	resp, err := d.open(ctx, http.MethodGet, endpoint, true, true, nil, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &ScanInfo{
+		Name:        path.Base(scan),
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// not the range asked for, fetch the whole scan instead
+			resp.Body.Close()
+			return d.openScan(ctx, kind, name, 0)
+		}
+		info.Offset = start
+		info.Size = size
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return d.openScan(ctx, kind, name, 0)
+	case resp.StatusCode == http.StatusNotFound:
+		// scanner returns 404 when scan can not be found, the error matches
+		// both ErrScanNotFound and ErrNotFound.
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		r := &response{endpoint: endpoint, statusCode: resp.StatusCode, data: data}
+		return nil, nil, fmt.Errorf("%w: %w", ErrScanNotFound, r.httpError())
+	case resp.StatusCode != http.StatusOK:
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		r := &response{endpoint: endpoint, statusCode: resp.StatusCode, data: data}
+		return nil, nil, r.httpError()
+	case resp.ContentLength == 0:
+		resp.Body.Close()
+		return nil, nil, ErrDownloadingScan
+	}
+
+	body := resp.Body
+
+	if d.progress != nil {
+		progress := Progress{Name: info.Name, Received: info.Offset, Total: info.Size}
+		body = &progressReader{ReadCloser: body, fn: d.progress, progress: progress}
+	}
+
+	// only the start of a scan has its magic bytes
+	if info.Offset == 0 {
+		body, info.ContentType = sniff(body, info.ContentType)
+	}
+
+	return body, info, nil
+}
+
+// parseContentRange parses a Content-Range header of the form
+// "bytes start-end/size", returning false if the size is unknown.
+func parseContentRange(s string) (start, size int64, ok bool) {
+	s = strings.TrimPrefix(s, "bytes ")
+
+	dash := strings.Index(s, "-")
+	slash := strings.Index(s, "/")
+	if dash < 0 || slash < dash {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(s[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	size, err = strconv.ParseInt(s[slash+1:], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, size, true
+}
+
+// progressReader reports the progress of reading a download.
+type progressReader struct {
+	io.ReadCloser
+	fn       func(Progress)
+	progress Progress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.progress.Received += int64(n)
+		r.fn(r.progress)
+	}
+	return n, err
+}
+
+// scanCheck records the size, and the first and last bytes, of a scan written
+// to it.
+type scanCheck struct {
+	size int64
+	head []byte
+	tail []byte
+}
+
+func (c *scanCheck) Write(p []byte) (int, error) {
+	if len(c.head) < 2 {
+		n := 2 - len(c.head)
+		if n > len(p) {
+			n = len(p)
+		}
+		c.head = append(c.head, p[:n]...)
+	}
+
+	if len(p) >= 2 {
+		c.tail = append(c.tail[:0], p[len(p)-2:]...)
+	} else {
+		c.tail = append(c.tail, p...)
+		if len(c.tail) > 2 {
+			c.tail = c.tail[len(c.tail)-2:]
+		}
+	}
+
+	c.size += int64(len(p))
+
+	return len(p), nil
+}
+
+// verify checks the scan called name is want bytes long, unless want is
+// negative, and if it is a JPEG that it starts with the start of image marker
+// and ends with the end of image marker.
+func (c *scanCheck) verify(name string, want int64, jpeg bool) error {
+	if want >= 0 && c.size < want {
+		return fmt.Errorf("%w: %s is %d bytes, want %d", ErrIncompleteDownload, name, c.size, want)
+	}
+
+	if want >= 0 && c.size > want {
+		return fmt.Errorf("%w: %s is %d bytes, want %d", ErrCorruptScan, name, c.size, want)
+	}
+
+	if !jpeg {
+		return nil
+	}
+
+	if !bytes.Equal(c.head, jpegSOI) {
+		return fmt.Errorf("%w: %s has no JPEG start of image marker", ErrCorruptScan, name)
+	}
+
+	if !bytes.Equal(c.tail, jpegEOI) {
+		return fmt.Errorf("%w: %s has no JPEG end of image marker", ErrIncompleteDownload, name)
+	}
+
+	return nil
+}
+
+// isJPEG reports whether the scan described by info is a JPEG.
+func isJPEG(info *ScanInfo) bool {
+	if info.ContentType != "" {
+		return mediaType(info.ContentType) == "image/jpeg"
+	}
+	ext := strings.ToUpper(path.Ext(info.Name))
+	return ext == ".JPG" || ext == ".JPEG"
+}
@@ -2,26 +2,42 @@ package doxiego
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
+	// decoders for the raster formats scanners save
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const doxieInternalPath = "/DOXIE/JPEG/"
+const (
+	// doxieInternalPath folder scans are assumed to be in when given by name,
+	// if the scanners capabilities do not say
+	doxieInternalPath = "/DOXIE/JPEG/"
+	// doxieUser the user name the scanner expects with its password
+	doxieUser = "doxie"
+)
 
 var (
-	// ErrHTTPRequest error when making a http request to the scanner
-	ErrHTTPRequest error
-	// ErrDoxieNotFound error when the scanner is not reachable
+	// ErrHTTPRequest error when making a http request to the scanner, every
+	// HTTPError matches it with errors.Is.
+	//
+	// Deprecated: use errors.As with *HTTPError or errors.Is with one of its
+	// classes, ErrUnauthorized, ErrBusy or ErrNotFound.
+	ErrHTTPRequest = errors.New("doxie: request error")
+	// ErrDoxieNotFound error when the scanner is not reachable, every NetError
+	// matches it with errors.Is.
 	ErrDoxieNotFound = errors.New("doxie: scanner not found on Wi-Fi network")
 	// ErrScanNotFound error when scans.json endpoint returns an empty body
 	ErrScanNotFound = errors.New("doxie: scan(s) not found scanners memory may be busy")
@@ -29,17 +45,29 @@ var (
 	ErrDeletingScan = errors.New("doxie: error deleting scan(s)")
 	// ErrDownloadingScan request for scan returns no data
 	ErrDownloadingScan = errors.New("doxie: error downloading scan")
+	// ErrIncompleteDownload a download was cut short, and retrying it did not
+	// complete it
+	ErrIncompleteDownload = errors.New("doxie: incomplete download")
+	// ErrCorruptScan a downloaded scan is longer than listed or is not a
+	// valid JPEG
+	ErrCorruptScan = errors.New("doxie: corrupt scan")
 	// ErrNoThumbnail thumbnail has not yet been generated.
 	ErrNoThumbnail = errors.New("doxie: thumbnail not yet generated")
 )
 
 var (
 	// APModeIP ip of scanner when it creates its own network
-	APModeIP = "192.168.1.100"
+	//
+	// Deprecated: set Config.APModeIP instead.
+	APModeIP = DefaultAPModeIP
 	// StaticIP of the scanner when it joins client network
+	//
+	// Deprecated: set Config.StaticIP instead.
 	StaticIP string
 	// Port default port of the doxie scanner
-	Port = 8080
+	//
+	// Deprecated: set Config.Port instead.
+	Port = DefaultPort
 )
 
 // Doxie represents a Doxie scanner instance
@@ -62,15 +90,45 @@ type Doxie struct {
 	IP string
 	// URL of the Doxie API
 	URL string
+	// Interface the scanner was found on by an SSDP search, if known
+	Interface string
 	// Scanner password
 	Password string
+	// Extra fields of hello.json which are not recognised, kept so a firmware
+	// update adding fields does not lose them
+	Extra map[string]json.RawMessage
+
+	httpClient      *http.Client
+	transport       http.RoundTripper
+	connectTimeout  time.Duration
+	metadataTimeout time.Duration
+	downloadTimeout time.Duration
+	userAgent       string
+	rediscovery     *rediscovery
+	identity        *identityPin
+	progress        func(Progress)
+	downloadRetries int
+	clock           *scannerClock
+	capabilities    *CapabilityTable
 }
 
 // ScanItem list of scans in the scanners memory
 type ScanItem struct {
-	Name     string
+	// Name of the scan e.g. "IMG_0001.JPG"
+	Name string
+	// Path of the scan on the scanner e.g. "/DOXIE/JPEG/IMG_0001.JPG", use it
+	// rather than Name to address the scan
+	Path     string
 	Size     int
 	Modified string
+	// ModifiedTime Modified parsed, as read from the scanners clock, which
+	// resets to 2010 when the scanner is switched on
+	ModifiedTime time.Time
+	// Scanned when the document was scanned, ModifiedTime corrected by the
+	// clock drift of the scanner, see EstimateClockDrift
+	Scanned time.Time
+	// Extra fields of the scans.json entry which are not recognised
+	Extra map[string]json.RawMessage
 }
 
 // helloExtra additional status values from the doxie scanner
@@ -79,10 +137,13 @@ type helloExtra struct {
 	Firmware string
 	// Scanners power source, true if AC false if battery power
 	ConnectedToExternalPower bool
+	// Extra fields of hello_extra.json which are not recognised
+	Extra map[string]json.RawMessage
 }
 
 // response wraps a response from the doxie scanner
 type response struct {
+	endpoint   string
 	statusCode int
 	data       []byte
 	err        error
@@ -92,87 +153,31 @@ type response struct {
 // password configuration. Accessing this command does not require a password if
 // one has been set. The values returned depend on whether the scanner is creating
 // its own network or joining an existing network.
+//
+// The scanner is searched for on the network it creates and, using SSDP, on the
+// network it joins. The first scanner found is returned, Hello only fails once
+// every search has failed, returning a *DiscoveryError with the reasons.
 func Hello() (*Doxie, error) {
-	findDoxieOnAPNetwork := func(chd chan *Doxie, che chan error) {
-		sayHello(APModeIP, chd, che)
-	}
-
-	findDoxieOnClientNetwork := func(chd chan *Doxie, che chan error) {
-		discover := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: urn:schemas-getdoxie-com:device:Scanner:1\r\n\r\n"
-
-		ssdpAddr, err := net.ResolveUDPAddr("udp4", "239.255.255.250:1900")
-		if err != nil {
-			che <- err
-			return
-		}
-
-		conn, err := net.ListenUDP("udp4", nil)
-		if err != nil {
-			che <- err
-			return
-		}
-
-		defer conn.Close()
-
-		_, err = conn.WriteTo([]byte(discover), ssdpAddr)
-		if err != nil {
-			che <- err
-			return
-		}
-
-		buffer := make([]byte, 1024)
-
-		_, addr, err := conn.ReadFrom(buffer)
-		if err != nil {
-			che <- err
-			return
-		}
-
-		ip := strings.Split(addr.String(), ":")
-
-		sayHello(ip[0], chd, che)
-	}
-
-	var dox *Doxie
-	var err error
-
-	chDox := make(chan *Doxie)
-	chErr := make(chan error)
-
-	// Find Doxie on the network it creates - 'AP' mode
-	go findDoxieOnAPNetwork(chDox, chErr)
-
-	// Find Doxie on the network it joins - 'Client' mode
-	go findDoxieOnClientNetwork(chDox, chErr)
-
-	select {
-	case dox = <-chDox:
-	case err = <-chErr:
-	}
+	return HelloContext(context.Background())
+}
 
-	return dox, err
+// HelloContext is like Hello but honours the cancellation and deadline of ctx,
+// both while searching for the scanner and while talking to it.
+func HelloContext(ctx context.Context) (*Doxie, error) {
+	return DefaultConfig().HelloContext(ctx)
 }
 
 // ScannerFirmware the scanners firmware version.
 func (d *Doxie) ScannerFirmware() (string, error) {
-	r := httpGetRequest(d.URL+"hello_extra.json", "")
-
-	if r.err != nil {
-		return "", r.err
-	}
-
-	if r.statusCode != http.StatusOK {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		return "", ErrHTTPRequest
-	}
-
-	var extra helloExtra
+	return d.ScannerFirmwareContext(context.Background())
+}
 
-	err := json.Unmarshal(r.data, &extra)
+// ScannerFirmwareContext is like ScannerFirmware but honours ctx.
+func (d *Doxie) ScannerFirmwareContext(ctx context.Context) (string, error) {
+	extra, err := d.helloExtra(ctx)
 	if err != nil {
 		return "", err
 	}
-
 	return extra.Firmware, nil
 }
 
@@ -180,30 +185,34 @@ func (d *Doxie) ScannerFirmware() (string, error) {
 // versus running on battery power. This value is not cached, so it immediately
 // reflects any state changes.
 func (d *Doxie) ExternalPower() (bool, error) {
-	r := httpGetRequest(d.URL+"hello_extra.json", "")
-
-	if r.err != nil {
-		return false, r.err
-	}
+	return d.ExternalPowerContext(context.Background())
+}
 
-	if r.statusCode != http.StatusOK {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		return false, ErrHTTPRequest
+// ExternalPowerContext is like ExternalPower but honours ctx.
+func (d *Doxie) ExternalPowerContext(ctx context.Context) (bool, error) {
+	if err := supports(d.Capabilities().ExternalPower, "external power"); err != nil {
+		return false, err
 	}
 
-	var extra helloExtra
-
-	err := json.Unmarshal(r.data, &extra)
+	extra, err := d.helloExtra(ctx)
 	if err != nil {
 		return false, err
 	}
-
 	return extra.ConnectedToExternalPower, nil
 }
 
 // Restart restarts the scanner's Wi-Fi system.
 func (d *Doxie) Restart() error {
-	r := httpGetRequest(d.URL+"restart.json", d.Password)
+	return d.RestartContext(context.Background())
+}
+
+// RestartContext is like Restart but honours ctx.
+func (d *Doxie) RestartContext(ctx context.Context) error {
+	if err := supports(d.Capabilities().Restart, "restart"); err != nil {
+		return err
+	}
+
+	r := d.httpGetRequest(ctx, "restart.json", true)
 
 	if r.err != nil {
 		return r.err
@@ -212,8 +221,7 @@ func (d *Doxie) Restart() error {
 	// DoxieGo returns http 204 No Content and then restarts the scanner's Wi-Fi
 	// system. The scanner's status light blinks blue during the restart.
 	if r.statusCode != http.StatusNoContent {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		return ErrHTTPRequest
+		return r.httpError()
 	}
 
 	return nil
@@ -225,31 +233,40 @@ func (d *Doxie) Restart() error {
 // even if there are other scans on the scanner, due to the scanner's memory
 // being in use. Consider retrying if len(ScanItems) is zero.
 func (d *Doxie) Scans() ([]ScanItem, error) {
-	r := httpGetRequest(d.URL+"scans.json", d.Password)
+	return d.ScansContext(context.Background())
+}
+
+// ScansContext is like Scans but honours ctx.
+func (d *Doxie) ScansContext(ctx context.Context) ([]ScanItem, error) {
+	r := d.httpGetRequest(ctx, "scans.json", true)
 
 	if r.err != nil {
 		return nil, r.err
 	}
 
 	if r.statusCode != http.StatusOK {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		return nil, ErrHTTPRequest
+		return nil, r.httpError()
 	}
 
-	var items []ScanItem
-
 	// no data sent from scanner
 	if len(r.data) == 0 {
 		return nil, ErrScanNotFound
 	}
 
-	err := json.Unmarshal(r.data, &items)
+	items, err := decodeScans(r.data)
 	if err != nil {
 		return nil, err
 	}
 
+	drift := d.ClockDrift()
+
 	for idx, i := range items {
+		items[idx].Path = i.Name
 		items[idx].Name = path.Base(i.Name)
+		if t, err := parseScanTime(i.Modified); err == nil {
+			items[idx].ModifiedTime = t
+			items[idx].Scanned = t.Add(drift)
+		}
 	}
 
 	return items, nil
@@ -258,7 +275,31 @@ func (d *Doxie) Scans() ([]ScanItem, error) {
 // Recent returns the last scan if available, if there is no recent scan
 // available, an empty string is returned.
 func (d *Doxie) Recent() (string, error) {
-	r := httpGetRequest(d.URL+"scans/recent.json", d.Password)
+	return d.RecentContext(context.Background())
+}
+
+// RecentContext is like Recent but honours ctx.
+func (d *Doxie) RecentContext(ctx context.Context) (string, error) {
+	recent, err := d.RecentPathContext(ctx)
+	if err != nil || recent == "" {
+		return "", err
+	}
+	return path.Base(recent), nil
+}
+
+// RecentPath is like Recent but returns the full path of the last scan on the
+// scanner, as in ScanItem.Path, to pass to Scan or ScanReader.
+func (d *Doxie) RecentPath() (string, error) {
+	return d.RecentPathContext(context.Background())
+}
+
+// RecentPathContext is like RecentPath but honours ctx.
+func (d *Doxie) RecentPathContext(ctx context.Context) (string, error) {
+	if err := supports(d.Capabilities().Recent, "recent scan"); err != nil {
+		return "", err
+	}
+
+	r := d.httpGetRequest(ctx, "scans/recent.json", true)
 
 	if r.err != nil {
 		return "", r.err
@@ -267,8 +308,7 @@ func (d *Doxie) Recent() (string, error) {
 	if r.statusCode == http.StatusNoContent {
 		return "", nil
 	} else if r.statusCode != http.StatusOK {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		return "", ErrHTTPRequest
+		return "", r.httpError()
 	}
 
 	var recent map[string]string
@@ -278,182 +318,299 @@ func (d *Doxie) Recent() (string, error) {
 		return "", err
 	}
 
-	_, ok := recent["path"]
-	if !ok && len(recent) < 1 {
-		return "", nil
-	}
-
-	return path.Base(recent["path"]), nil
+	return recent["path"], nil
 }
 
-// Scan gets a scanned item by name.
+// Scan gets a scanned item by its path, as in ScanItem.Path, or by name, and
+// decodes it. Returns error ErrNotImage for a scan which is not an image, such
+// as a PDF, use ScanDocument to fetch those.
 func (d *Doxie) Scan(name string) (image.Image, error) {
-	return getScanHelper(d.URL, "scans", name, d.Password)
+	return d.ScanContext(context.Background(), name)
+}
+
+// ScanContext is like Scan but honours ctx.
+func (d *Doxie) ScanContext(ctx context.Context, name string) (image.Image, error) {
+	return d.getScanHelper(ctx, "scans", name)
 }
 
 // Thumbnail gets a 240x240 thumbnail of the scan. Returns error ErrNoThumbnail
 // if the thumbnail has not yet been generated, retrying after a delay is
 // recommended to handle such cases.
 func (d *Doxie) Thumbnail(name string) (image.Image, error) {
-	img, err := getScanHelper(d.URL, "thumbnails", name, d.Password)
-	if err == ErrScanNotFound {
+	return d.ThumbnailContext(context.Background(), name)
+}
+
+// ThumbnailContext is like Thumbnail but honours ctx.
+func (d *Doxie) ThumbnailContext(ctx context.Context, name string) (image.Image, error) {
+	img, err := d.getScanHelper(ctx, "thumbnails", name)
+	if errors.Is(err, ErrScanNotFound) {
 		return img, ErrNoThumbnail
 	}
 	return img, err
 }
 
-// Delete deletes multiple scans in a single operation.
+// Delete deletes multiple scans in a single operation, each given by its path,
+// as in ScanItem.Path, or by name.
 func (d *Doxie) Delete(items ...string) (bool, error) {
+	return d.DeleteContext(context.Background(), items...)
+}
+
+// DeleteContext is like Delete but honours ctx.
+func (d *Doxie) DeleteContext(ctx context.Context, items ...string) (bool, error) {
+	if err := supports(d.Capabilities().Delete, "delete"); err != nil {
+		return false, err
+	}
+
 	var body string
 	for idx, s := range items {
+		scan, err := d.scanPath(s)
+		if err != nil {
+			return false, err
+		}
 		if idx == len(items)-1 {
-			body = body + strconv.Quote(doxieInternalPath+strings.ToUpper(s))
+			body = body + strconv.Quote(scan)
 		} else {
-			body = body + strconv.Quote(doxieInternalPath+strings.ToUpper(s)) + ","
+			body = body + strconv.Quote(scan) + ","
 		}
 	}
 
-	buf := bytes.NewBufferString("[" + body + "]")
-
-	var url string
-	if d.Password != "" {
-		url = addAuthToURL(d.URL, d.Password)
-	} else {
-		url = d.URL
-	}
-
-	resp, err := http.Post(url+"scans/delete.json", "application/json", buf)
-	if err != nil {
-		return false, err
-	}
+	r := d.httpRequest(ctx, http.MethodPost, "scans/delete.json", true, false, []byte("["+body+"]"))
 
-	if resp != nil {
-		defer resp.Body.Close()
+	if r.err != nil {
+		return false, r.err
 	}
 
 	// scanner returns 204 if successful
-	if resp.StatusCode != http.StatusNoContent {
-		return false, ErrDeletingScan
+	if r.statusCode != http.StatusNoContent {
+		return false, fmt.Errorf("%w: %w", ErrDeletingScan, r.httpError())
 	}
 
 	return true, nil
 }
 
-// addAuthToURL inserts username:password into a URL.
-func addAuthToURL(url, password string) string {
-	if strings.HasPrefix(url, "http://") {
-		url = fmt.Sprintf("http://doxie:%s@%s", password, url[7:])
-	} else {
-		// assumes d.URL is in form 192.168.1.100:8080
-		url = fmt.Sprintf("http://doxie:%s@%s", password, url)
-	}
-	return url
-}
-
-// getScanHelper helper function retrieves a jpeg scan from the scanner.
-func getScanHelper(url, path, name, password string) (image.Image, error) {
-	r := httpGetRequest(url+path+doxieInternalPath+strings.ToUpper(name), password)
+// helloExtra fetches the additional status values from the scanner.
+func (d *Doxie) helloExtra(ctx context.Context) (*helloExtra, error) {
+	r := d.httpGetRequest(ctx, "hello_extra.json", false)
 
 	if r.err != nil {
 		return nil, r.err
 	}
 
-	// scanner returns 404 when scan can not be found.
-	if r.statusCode == http.StatusNotFound {
-		return nil, ErrScanNotFound
-	} else if r.statusCode != http.StatusOK {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		return nil, ErrHTTPRequest
+	if r.statusCode != http.StatusOK {
+		return nil, r.httpError()
 	}
 
-	if len(r.data) == 0 {
-		return nil, ErrDownloadingScan
+	var extra helloExtra
+
+	err := decodeLenient(r.data, &extra, helloExtraFields)
+	if err != nil {
+		return nil, err
 	}
 
-	var b bytes.Buffer
-	b.Write(r.data)
+	return &extra, nil
+}
 
-	img, err := jpeg.Decode(&b)
+// getScanHelper helper function retrieves a scan from the scanner and decodes
+// it as an image.
+func (d *Doxie) getScanHelper(ctx context.Context, path, name string) (image.Image, error) {
+	body, info, err := d.openScan(ctx, path, name, 0)
 	if err != nil {
 		return nil, err
 	}
+	defer body.Close()
+
+	if !strings.HasPrefix(info.ContentType, "image/") {
+		return nil, fmt.Errorf("%w: %s is %s", ErrNotImage, info.Name, info.ContentType)
+	}
+
+	img, _, err := image.Decode(body)
+	switch {
+	case errors.Is(err, ErrIncompleteDownload):
+		return nil, err
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, fmt.Errorf("%w: %s ends early", ErrIncompleteDownload, name)
+	case err != nil:
+		return nil, err
+	}
 
 	return img, nil
 }
 
-// sayHello connects to the scanner.
-func sayHello(ip string, chd chan *Doxie, che chan error) {
-	var url string
-	if StaticIP != "" {
-		url = fmt.Sprintf("http://%s:%d/", StaticIP, Port)
-	} else {
-		url = fmt.Sprintf("http://%s:%d/", ip, Port)
+// watchConn unblocks any pending reads on conn once ctx is done. The returned
+// function must be called to release the watcher.
+func watchConn(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// httpGetRequest makes a GET request to a scanner endpoint
+func (d *Doxie) httpGetRequest(ctx context.Context, endpoint string, auth bool) *response {
+	return d.httpRequest(ctx, http.MethodGet, endpoint, auth, false, nil)
+}
+
+// httpRequest makes a request to a scanner endpoint. Requests which do not
+// complete within the metadata or download timeout, or cannot reach the
+// scanner, fail with a NetError. Requests aborted through ctx fail with
+// ctx.Err(). If rediscovery is enabled a request which cannot reach the
+// scanner is retried once at its new address. Requests to endpoints which
+// need auth send the password using HTTP Basic auth, or fail with
+// ErrPasswordRequired if the scanner has a password but none is set.
+func (d *Doxie) httpRequest(ctx context.Context, method, endpoint string, auth, download bool, body []byte) *response {
+	resp, err := d.open(ctx, method, endpoint, auth, download, body, nil)
+	return readResponse(endpoint, resp, err)
+}
+
+// open makes a request to a scanner endpoint as httpRequest does, with the
+// extra header, but returns the response unread. The caller must close the
+// response body.
+func (d *Doxie) open(ctx context.Context, method, endpoint string, auth, download bool, body []byte, header http.Header) (*http.Response, error) {
+	if auth && d.HasPassword && d.Password == "" {
+		return nil, ErrPasswordRequired
 	}
 
-	r := httpGetRequest(url+"hello.json", "")
+	base := d.baseURL()
 
-	if r.err != nil {
-		che <- r.err
-		return
+	resp, err := d.send(ctx, base, method, endpoint, auth, download, body, header)
+
+	if d.shouldRediscover(ctx, err) && d.rediscover(ctx, base) == nil {
+		resp, err = d.send(ctx, d.baseURL(), method, endpoint, auth, download, body, header)
 	}
 
-	if r.statusCode != http.StatusOK {
-		ErrHTTPRequest = errors.New("doxie: request error http " + strconv.Itoa(r.statusCode))
-		che <- ErrHTTPRequest
-		return
+	return resp, err
+}
+
+// send makes a single request to endpoint of the scanner API at base, with
+// the extra header. The caller must close the response body, reading it fails
+// with a NetError if the scanner stops answering.
+func (d *Doxie) send(ctx context.Context, base, method, endpoint string, auth, download bool, body []byte, header http.Header) (*http.Response, error) {
+	auth = auth && d.Password != ""
+	if auth {
+		if err := d.verifyIdentity(ctx, base); err != nil {
+			return nil, err
+		}
 	}
 
-	var dox Doxie
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, d.timeout(download))
+
+	// the host at base is only trusted for as long as the connection the
+	// identity was checked over
+	traceCtx := reqCtx
+	if d.identity != nil {
+		traceCtx = httptrace.WithClientTrace(reqCtx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if !info.Reused {
+					d.identity.forget(base)
+				}
+			},
+		})
+	}
 
-	err := json.Unmarshal(r.data, &dox)
+	req, err := http.NewRequestWithContext(traceCtx, method, base+endpoint, reader)
 	if err != nil {
-		che <- err
-		return
+		cancel()
+		return nil, err
 	}
 
-	dox.URL = url
+	for key, values := range header {
+		req.Header[key] = values
+	}
 
-	chd <- &dox
-}
+	if auth {
+		req.SetBasicAuth(doxieUser, d.Password)
+	}
 
-// httpGetRequest makes a request to a HTTP endpoint
-func httpGetRequest(url, password string) *response {
-	ch := make(chan *response)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	go func() {
-		if password != "" {
-			url = addAuthToURL(url, password)
-		}
-		resp, err := http.Get(url)
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
 
-		if err != nil {
-			ch <- &response{data: nil, err: err}
-			return
+	resp, err := d.client().Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-
-		if resp != nil {
-			defer resp.Body.Close()
+		if d.identity != nil {
+			d.identity.forget(base)
 		}
+		return nil, newNetError(reqCtx, endpoint, err)
+	}
 
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			ch <- &response{data: nil, err: err}
-			return
-		}
+	resp.Body = &responseBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		reqCtx:     reqCtx,
+		cancel:     cancel,
+		endpoint:   endpoint,
+	}
 
-		ch <- &response{statusCode: resp.StatusCode, data: body, err: err}
-	}()
+	return resp, nil
+}
 
-	var resp *response
-	select {
-	case r := <-ch:
-		resp = r
-	case <-time.After(5 * time.Second):
-		resp = &response{statusCode: http.StatusNotFound,
-			data: nil,
-			err:  ErrDoxieNotFound,
+// readResponse reads and closes the body of resp, the result of a request to
+// endpoint which failed with err.
+func readResponse(endpoint string, resp *http.Response, err error) *response {
+	if err != nil {
+		return &response{endpoint: endpoint, err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &response{endpoint: endpoint, err: err}
+	}
+
+	return &response{endpoint: endpoint, statusCode: resp.StatusCode, data: data}
+}
+
+// responseBody the body of a response from the scanner, which releases the
+// request timeout once closed.
+type responseBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	reqCtx   context.Context
+	cancel   context.CancelFunc
+	endpoint string
+}
+
+// Read reads from the body, returning ctx.Err() if the caller gave up,
+// ErrIncompleteDownload if the body ends before its Content-Length or a
+// NetError if the scanner stopped answering.
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		switch {
+		case b.ctx.Err() != nil:
+			err = b.ctx.Err()
+		case err == io.ErrUnexpectedEOF:
+			err = fmt.Errorf("%w: %s: %w", ErrIncompleteDownload, b.endpoint, err)
+		default:
+			err = newNetError(b.reqCtx, b.endpoint, err)
 		}
 	}
+	return n, err
+}
 
-	return resp
+// Close closes the body and releases the request timeout.
+func (b *responseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
@@ -1,23 +1,40 @@
 package doxiego_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/umahmood/doxiego"
 )
 
 // respFlags set by various tests, controls response of the test server
 var respFlags struct {
-	clientMode  bool
-	emptyScans  bool
-	noRecent    bool
-	delNotFound bool
+	clientMode   bool
+	emptyScans   bool
+	noRecent     bool
+	delNotFound  bool
+	slowHello    bool
+	slowScans    bool
+	unauthorized bool
+	passwordSet  bool
 }
 
 // byte representation on a jpeg image
@@ -36,17 +53,30 @@ var testScan = []byte{255, 216, 255, 224, 0, 16, 74, 70, 73, 70, 0, 1, 1, 1,
 	20, 17, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 255, 218, 0, 12,
 	3, 1, 0, 2, 17, 3, 17, 0, 63, 0, 152, 0, 142, 126, 191, 255, 217}
 
-func startTestServer() *httptest.Server {
-	s := make(chan struct{})
-	var ts *httptest.Server
+// testPDF a minimal PDF document
+var testPDF = []byte("%PDF-1.4\n1 0 obj << /Type /Catalog >> endobj\ntrailer << /Root 1 0 R >>\n%%EOF\n")
 
-	go func() {
-		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			p := r.URL.Path
-			switch p {
-			case "/hello.json":
-				if respFlags.clientMode {
-					fmt.Fprintf(w, `{ "model": "DX250",
+// recordingTransport records the requests made through it.
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, r)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func startTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		switch p {
+		case "/hello.json":
+			if respFlags.slowHello {
+				<-r.Context().Done()
+				return
+			}
+			if respFlags.clientMode {
+				fmt.Fprintf(w, `{ "model": "DX250",
                         "name": "Doxie_042D6A",
                         "firmwareWiFi": "1.29",
                         "hasPassword": false,
@@ -54,8 +84,8 @@ func startTestServer() *httptest.Server {
                         "mode": "Client",
                         "network": "my-wifi",
                         "ip": "192.168.0.18"}`)
-				} else {
-					fmt.Fprintf(w, `{ "model": "DX250",
+			} else {
+				fmt.Fprintf(w, `{ "model": "DX250",
                         "name": "Doxie_042D6A",
                         "firmwareWiFi": "1.29",
                         "hasPassword": false,
@@ -63,68 +93,92 @@ func startTestServer() *httptest.Server {
                         "mode": "AP",
                         "network": "",
                         "ip": ""}`)
-				}
-				// fmt.Fprintf(w, r)
-			case "/hello_extra.json":
-				fmt.Fprintf(w, `{ "firmware": "0.26", 
-					"connectedToExternalPower": true}`)
-			case "/restart.json":
+			}
+			// fmt.Fprintf(w, r)
+		case "/hello_extra.json":
+			fmt.Fprintf(w, `{ "firmware": "0.26", 
+				"connectedToExternalPower": true}`)
+		case "/restart.json":
+			w.WriteHeader(http.StatusNoContent)
+		case "/scans.json":
+			if user, password, _ := r.BasicAuth(); respFlags.passwordSet &&
+				(user != "doxie" || password != "mypassword") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if respFlags.unauthorized {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if respFlags.slowScans {
+				<-r.Context().Done()
+				return
+			}
+			if respFlags.emptyScans {
+				fmt.Fprintf(w, "[]")
+			} else {
+				fmt.Fprintf(w, `[{
+                    "name":"/DOXIE/JPEG/IMG_0001.JPG",
+                    "size":241220,
+                    "modified":"2010-05-01 00:10:06"
+                    },
+                    {
+                    "name":"/DOXIE/JPEG/IMG_0002.JPG",
+                    "size":265085,
+                    "modified":"2010-05-01 00:09:26"
+                    },
+                    {
+                    "name":"/DOXIE/JPEG/IMG_0003.JPG",
+                    "size":273522,
+                    "modified":"2010-05-01 00:09:44"
+                    }]`)
+			}
+		case "/scans/recent.json":
+			if respFlags.noRecent {
 				w.WriteHeader(http.StatusNoContent)
-			case "/scans.json":
-				if respFlags.emptyScans {
-					fmt.Fprintf(w, "[]")
-				} else {
-					fmt.Fprintf(w, `[{
-	                    "name":"/DOXIE/JPEG/IMG_0001.JPG",
-	                    "size":241220,
-	                    "modified":"2010-05-01 00:10:06"
-	                    },
-	                    {
-	                    "name":"/DOXIE/JPEG/IMG_0002.JPG",
-	                    "size":265085,
-	                    "modified":"2010-05-01 00:09:26"
-	                    },
-	                    {
-	                    "name":"/DOXIE/JPEG/IMG_0003.JPG",
-	                    "size":273522,
-	                    "modified":"2010-05-01 00:09:44"
-	                    }]`)
-				}
-			case "/scans/recent.json":
-				if respFlags.noRecent {
-					w.WriteHeader(http.StatusNoContent)
-				} else {
-					fmt.Fprintf(w, `{"path":"/DOXIE/JPEG/IMG_0003.JPG"}`)
-				}
-			case "/scans/DOXIE/JPEG/IMG_001.JPG":
-				w.WriteHeader(http.StatusOK)
-				w.Header().Set("Content-Type", "image/jpeg")
-				w.Write(testScan)
-			case "/thumbnails/DOXIE/JPEG/IMG_001.JPG":
-				w.WriteHeader(http.StatusOK)
-				w.Header().Set("Content-Type", "image/jpeg")
-				w.Write(testScan)
-			case "/scans/delete.json":
-				if respFlags.delNotFound {
-					w.WriteHeader(http.StatusForbidden)
-				} else {
-					w.WriteHeader(http.StatusNoContent)
-				}
-			default:
-				w.WriteHeader(http.StatusNotFound)
+			} else {
+				fmt.Fprintf(w, `{"path":"/DOXIE/JPEG/IMG_0003.JPG"}`)
 			}
-		}))
-		endPoint := strings.Split(ts.URL[7:], ":")
-		doxiego.APModeIP = endPoint[0]
-		p, err := strconv.Atoi(endPoint[1])
-		if err != nil {
-			log.Fatalln(err)
+		case "/scans/DOXIE/JPEG/IMG_001.JPG":
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(testScan)
+		case "/scans/DOXIE/JPEG_2/img_0004.jpg":
+			// a folder and lower case name not used by the DX250
+			w.Write(testScan)
+		case "/scans/DOXIE/PDF/DOC_0001.PDF":
+			w.Write(testPDF)
+		case "/scans/DOXIE/JPEG/IMG_0005.JPG":
+			// a PNG, whatever the scanner says
+			w.Header().Set("Content-Type", "image/jpeg")
+			png.Encode(w, image.NewGray(image.Rect(0, 0, 2, 2)))
+		case "/scans/DOXIE/JPEG/IMG_002.JPG":
+			// honours Range requests
+			http.ServeContent(w, r, "IMG_002.JPG", time.Time{}, bytes.NewReader(testScan))
+		case "/thumbnails/DOXIE/JPEG/IMG_001.JPG":
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(testScan)
+		case "/scans/delete.json":
+			if respFlags.delNotFound {
+				w.WriteHeader(http.StatusForbidden)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
 		}
-		doxiego.Port = p
-		s <- struct{}{}
-	}()
-	_ = <-s
-	return ts
+	}))
+}
+
+// testConfig returns a Config which finds the scanner served by ts.
+func testConfig(ts *httptest.Server) *doxiego.Config {
+	endPoint := strings.Split(ts.URL[7:], ":")
+	p, err := strconv.Atoi(endPoint[1])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return &doxiego.Config{APModeIP: endPoint[0], Port: p}
 }
 
 func TestHelloAPMode(t *testing.T) {
@@ -143,7 +197,7 @@ func TestHelloAPMode(t *testing.T) {
 		URL:          ts.URL + "/",
 	}
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -200,7 +254,7 @@ func TestHelloClientMode(t *testing.T) {
 		URL:          ts.URL + "/",
 	}
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -241,7 +295,7 @@ func TestPasswordField(t *testing.T) {
 
 	wantPwd := "mypassword"
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -261,7 +315,7 @@ func TestScannerFirmware(t *testing.T) {
 
 	want := "0.26"
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -282,7 +336,7 @@ func TestExternalPower(t *testing.T) {
 
 	want := true
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -301,7 +355,7 @@ func TestRestart(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -315,7 +369,7 @@ func TestScansWithResults(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -360,7 +414,7 @@ func TestScansNoResults(t *testing.T) {
 
 	respFlags.emptyScans = true
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -379,7 +433,7 @@ func TestRecentWithResult(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -405,7 +459,7 @@ func TestRecentNoResult(t *testing.T) {
 
 	respFlags.noRecent = true
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -424,7 +478,7 @@ func TestScanFound(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -443,14 +497,14 @@ func TestScanNotFound(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
 
 	got, err := doxieGo.Scan("IMG_BLAH.JPG")
 
-	if err != doxiego.ErrScanNotFound {
+	if !errors.Is(err, doxiego.ErrScanNotFound) || !errors.Is(err, doxiego.ErrNotFound) {
 		t.Errorf("%s", err)
 	}
 
@@ -463,7 +517,7 @@ func TestThumbnailFound(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -483,7 +537,7 @@ func TestThumbnailNotFound(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -503,7 +557,7 @@ func TestDeleteValidFiles(t *testing.T) {
 	ts := startTestServer()
 	defer ts.Close()
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -529,7 +583,7 @@ func TestDeleteSomeInvalidFiles(t *testing.T) {
 
 	respFlags.delNotFound = true
 
-	doxieGo, err := doxiego.Hello()
+	doxieGo, err := testConfig(ts).Hello()
 	if err != nil {
 		t.Errorf("%s", err)
 	}
@@ -541,7 +595,1660 @@ func TestDeleteSomeInvalidFiles(t *testing.T) {
 		t.Errorf("delete: want non-nil err got nil")
 	}
 
+	if errors.Is(err, doxiego.ErrUnauthorized) {
+		t.Errorf("delete: missing scans should not match %v", doxiego.ErrUnauthorized)
+	}
+
 	if got != false {
 		t.Errorf("delete: want false got %t", got)
 	}
 }
+
+func TestHelloContextDeadline(t *testing.T) {
+	ts := startTestServer()
+	defer func() {
+		ts.Close()
+		respFlags.slowHello = false
+	}()
+
+	respFlags.slowHello = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	doxieGo, err := testConfig(ts).HelloContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hello: want context.DeadlineExceeded got %v", err)
+	}
+
+	if doxieGo != nil {
+		t.Errorf("hello: want nil got %v", doxieGo)
+	}
+}
+
+func TestScansContextCanceled(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo, err := testConfig(ts).Hello()
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = doxieGo.ScansContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("scans: want context.Canceled got %v", err)
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	rt := &recordingTransport{}
+
+	doxieGo := doxiego.NewClient(ts.URL,
+		doxiego.WithTransport(rt),
+		doxiego.WithUserAgent("doxiego-test"))
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("new client: URL want %s got %s", want, doxieGo.URL)
+	}
+
+	if _, err := doxieGo.Scans(); err != nil {
+		t.Errorf("%s", err)
+	}
+
+	if len(rt.requests) != 1 {
+		t.Fatalf("new client: requests want %d got %d", 1, len(rt.requests))
+	}
+
+	if got := rt.requests[0].UserAgent(); got != "doxiego-test" {
+		t.Errorf("new client: User-Agent want %s got %s", "doxiego-test", got)
+	}
+}
+
+func TestMetadataTimeout(t *testing.T) {
+	ts := startTestServer()
+	defer func() {
+		ts.Close()
+		respFlags.slowScans = false
+	}()
+
+	respFlags.slowScans = true
+
+	doxieGo := doxiego.NewClient(ts.URL,
+		doxiego.WithMetadataTimeout(50*time.Millisecond))
+
+	_, err := doxieGo.Scans()
+	if !errors.Is(err, doxiego.ErrDoxieNotFound) {
+		t.Errorf("scans: want %v got %v", doxiego.ErrDoxieNotFound, err)
+	}
+
+	if !errors.Is(err, doxiego.ErrTimeout) {
+		t.Errorf("scans: want %v got %v", doxiego.ErrTimeout, err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	ts := startTestServer()
+	defer func() {
+		ts.Close()
+		respFlags.unauthorized = false
+	}()
+
+	respFlags.unauthorized = true
+
+	doxieGo, err := testConfig(ts).Hello()
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	_, err = doxieGo.Scans()
+	if !errors.Is(err, doxiego.ErrUnauthorized) {
+		t.Errorf("scans: want %v got %v", doxiego.ErrUnauthorized, err)
+	}
+
+	if errors.Is(err, doxiego.ErrBusy) {
+		t.Errorf("scans: %v should not match %v", err, doxiego.ErrBusy)
+	}
+
+	var httpErr *doxiego.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("scans: want *doxiego.HTTPError got %T", err)
+	}
+
+	if httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("scans: StatusCode want %d got %d", http.StatusUnauthorized, httpErr.StatusCode)
+	} else if httpErr.Endpoint != "scans.json" {
+		t.Errorf("scans: Endpoint want %s got %s", "scans.json", httpErr.Endpoint)
+	}
+}
+
+func TestHelloDeprecatedGlobals(t *testing.T) {
+	ts := startTestServer()
+
+	apModeIP, port := doxiego.APModeIP, doxiego.Port
+	defer func() {
+		ts.Close()
+		doxiego.APModeIP, doxiego.Port = apModeIP, port
+	}()
+
+	cfg := testConfig(ts)
+	doxiego.APModeIP, doxiego.Port = cfg.APModeIP, cfg.Port
+
+	doxieGo, err := doxiego.Hello()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("hello: URL want %s got %s", want, doxieGo.URL)
+	}
+}
+
+func TestConfigsConcurrent(t *testing.T) {
+	ts1 := startTestServer()
+	defer ts1.Close()
+	ts2 := startTestServer()
+	defer ts2.Close()
+
+	servers := []*httptest.Server{ts1, ts2}
+	urls := make([]string, len(servers))
+	errs := make([]error, len(servers))
+
+	var wg sync.WaitGroup
+	for idx, ts := range servers {
+		wg.Add(1)
+		go func(idx int, cfg *doxiego.Config) {
+			defer wg.Done()
+			doxieGo, err := cfg.Hello()
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			urls[idx] = doxieGo.URL
+		}(idx, testConfig(ts))
+	}
+	wg.Wait()
+
+	for idx, ts := range servers {
+		if errs[idx] != nil {
+			t.Errorf("%s", errs[idx])
+		} else if want := ts.URL + "/"; urls[idx] != want {
+			t.Errorf("hello: URL want %s got %s", want, urls[idx])
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo, err := doxiego.Dial(context.Background(), ts.URL[7:],
+		doxiego.WithPassword("mypassword"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if doxieGo.Name != "Doxie_042D6A" {
+		t.Errorf("dial: Name want %s got %s", "Doxie_042D6A", doxieGo.Name)
+	} else if doxieGo.Password != "mypassword" {
+		t.Errorf("dial: Password want %s got %s", "mypassword", doxieGo.Password)
+	} else if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("dial: URL want %s got %s", want, doxieGo.URL)
+	}
+}
+
+func TestDialDefaultPort(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	cfg := testConfig(ts)
+
+	doxieGo, err := cfg.Dial(context.Background(), cfg.APModeIP)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("dial: URL want %s got %s", want, doxieGo.URL)
+	}
+}
+
+func TestDialAddressForms(t *testing.T) {
+	srv := startTestServer()
+	defer srv.Close()
+
+	tls := httptest.NewTLSServer(srv.Config.Handler)
+	defer tls.Close()
+
+	doxieGo, err := doxiego.Dial(context.Background(), tls.URL, doxiego.WithHTTPClient(tls.Client()))
+	if err != nil {
+		t.Fatalf("dial %s: %s", tls.URL, err)
+	}
+
+	if want := tls.URL + "/"; doxieGo.URL != want {
+		t.Errorf("dial: URL want %s got %s", want, doxieGo.URL)
+	}
+
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %s", err)
+	}
+
+	ts := httptest.NewUnstartedServer(srv.Config.Handler)
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	cfg := &doxiego.Config{Port: l.Addr().(*net.TCPAddr).Port}
+
+	for _, addr := range []string{"::1", "[::1]", "http://[::1]"} {
+		doxieGo, err := cfg.Dial(context.Background(), addr)
+		if err != nil {
+			t.Errorf("dial %s: %s", addr, err)
+			continue
+		}
+
+		if want := ts.URL + "/"; doxieGo.URL != want {
+			t.Errorf("dial %s: URL want %s got %s", addr, want, doxieGo.URL)
+		}
+	}
+}
+
+// startSSDPResponder answers every SSDP search it receives with each of the
+// given responses, and returns its address.
+func startSSDPResponder(t *testing.T, responses ...string) string {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			_, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			for _, r := range responses {
+				conn.WriteToUDP([]byte(r), addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// ssdpResponse an SSDP search response from a Doxie scanner.
+const ssdpResponse = "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nEXT:\r\nST: urn:schemas-getdoxie-com:device:Scanner:1\r\nUSN: uuid:00-11-E5-04-2D-6A::urn:schemas-getdoxie-com:device:Scanner:1\r\n\r\n"
+
+func TestDiscoverAll(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	cfg := testConfig(ts)
+	cfg.SSDPAddr = startSSDPResponder(t, ssdpResponse, ssdpResponse)
+
+	doxies, err := cfg.DiscoverAll(context.Background(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(doxies) != 1 {
+		t.Fatalf("discover all: scanners want %d got %d", 1, len(doxies))
+	}
+
+	if doxies[0].MAC != "00:11:E5:04:2D:6A" {
+		t.Errorf("discover all: MAC want %s got %s", "00:11:E5:04:2D:6A", doxies[0].MAC)
+	}
+}
+
+func TestDiscoverAllNotFound(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	cfg := testConfig(ts)
+	cfg.SSDPAddr = startSSDPResponder(t)
+
+	_, err := cfg.DiscoverAll(context.Background(), 100*time.Millisecond)
+	if err != doxiego.ErrDoxieNotFound {
+		t.Errorf("discover all: want %v got %v", doxiego.ErrDoxieNotFound, err)
+	}
+}
+
+func TestHelloAPFailsSSDPFinds(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	// nothing listens on 127.0.0.2 so the AP mode search fails first
+	cfg := testConfig(ts)
+	cfg.APModeIP = "127.0.0.2"
+	cfg.SSDPAddr = startSSDPResponder(t, ssdpResponse)
+
+	doxieGo, err := cfg.Hello()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("hello: URL want %s got %s", want, doxieGo.URL)
+	}
+}
+
+func TestHelloAllStrategiesFail(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	cfg := testConfig(ts)
+	cfg.APModeIP = "127.0.0.2"
+	cfg.SSDPAddr = startSSDPResponder(t)
+	cfg.SearchWindow = 100 * time.Millisecond
+
+	_, err := cfg.Hello()
+	if !errors.Is(err, doxiego.ErrDoxieNotFound) {
+		t.Errorf("hello: want %v got %v", doxiego.ErrDoxieNotFound, err)
+	}
+
+	var discoveryErr *doxiego.DiscoveryError
+	if !errors.As(err, &discoveryErr) {
+		t.Fatalf("hello: want *doxiego.DiscoveryError got %T", err)
+	}
+
+	if len(discoveryErr.Errs) != 2 {
+		t.Errorf("hello: errors want %d got %d", 2, len(discoveryErr.Errs))
+	}
+
+	if !errors.Is(err, doxiego.ErrTimeout) {
+		t.Errorf("hello: want %v in %v", doxiego.ErrTimeout, err)
+	}
+}
+
+func TestDiscoverAllSSDPLocation(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	response := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nEXT:\r\nLOCATION: " + ts.URL + "/\r\nSERVER: Doxie/1.29 UPnP/1.0\r\nST: urn:schemas-getdoxie-com:device:Scanner:1\r\nUSN: uuid:00-11-E5-04-2D-6A::urn:schemas-getdoxie-com:device:Scanner:1\r\n\r\n"
+
+	// the port only comes from the advertised location
+	cfg := &doxiego.Config{Port: 1}
+	cfg.SSDPAddr = startSSDPResponder(t, response)
+
+	doxies, err := cfg.DiscoverAll(context.Background(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; len(doxies) != 1 || doxies[0].URL != want {
+		t.Errorf("discover all: want one scanner at %s got %v", want, doxies)
+	}
+}
+
+func TestDiscoverAllRejectsOtherDevices(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	otherDevice := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nEXT:\r\nLOCATION: " + ts.URL + "/\r\nST: urn:schemas-upnp-org:device:MediaRenderer:1\r\nUSN: uuid:media-renderer\r\n\r\n"
+	otherHost := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nEXT:\r\nLOCATION: http://192.0.2.1:8080/\r\nST: urn:schemas-getdoxie-com:device:Scanner:1\r\nUSN: uuid:00-11-E5-04-2D-6A\r\n\r\n"
+
+	cfg := testConfig(ts)
+	cfg.SSDPAddr = startSSDPResponder(t, otherDevice, otherHost, "not ssdp")
+
+	_, err := cfg.DiscoverAll(context.Background(), 100*time.Millisecond)
+	if err != doxiego.ErrDoxieNotFound {
+		t.Errorf("discover all: want %v got %v", doxiego.ErrDoxieNotFound, err)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	// reserve a port for the monitor to listen on
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	ssdpAddr := l.LocalAddr().(*net.UDPAddr)
+	l.Close()
+
+	cfg := testConfig(ts)
+	cfg.SSDPAddr = ssdpAddr.String()
+
+	monitor, err := cfg.Monitor(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	conn, err := net.DialUDP("udp4", nil, ssdpAddr)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer conn.Close()
+
+	notify := func(nts string) {
+		msg := "NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nCACHE-CONTROL: max-age=1800\r\nLOCATION: " + ts.URL + "/\r\nNT: urn:schemas-getdoxie-com:device:Scanner:1\r\nNTS: " + nts + "\r\nUSN: uuid:00-11-E5-04-2D-6A\r\n\r\n"
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	next := func() doxiego.Event {
+		select {
+		case e := <-monitor.Events():
+			return e
+		case <-time.After(time.Second):
+			t.Fatalf("monitor: no event received")
+		}
+		return doxiego.Event{}
+	}
+
+	notify("ssdp:alive")
+	if e := next(); e.Type != doxiego.ScannerAlive || e.URL != ts.URL+"/" {
+		t.Errorf("monitor: want alive event for %s got %s %s", ts.URL+"/", e.Type, e.URL)
+	}
+
+	// repeated announcements of a present scanner are not reported
+	notify("ssdp:alive")
+	notify("ssdp:byebye")
+	if e := next(); e.Type != doxiego.ScannerByeBye || e.USN != "uuid:00-11-E5-04-2D-6A" {
+		t.Errorf("monitor: want byebye event for %s got %s %s", "uuid:00-11-E5-04-2D-6A", e.Type, e.USN)
+	}
+
+	monitor.Close()
+
+	if _, ok := <-monitor.Events(); ok {
+		t.Errorf("monitor: events channel not closed")
+	}
+}
+
+func TestDiscovererComposition(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	errInventory := errors.New("inventory unavailable")
+
+	inventory := doxiego.DiscovererFunc(func(ctx context.Context) ([]*doxiego.Doxie, error) {
+		return nil, errInventory
+	})
+
+	cfg := testConfig(ts)
+	cfg.Discoverer = doxiego.InOrder(inventory, cfg.Static(ts.URL[7:]))
+
+	doxieGo, err := cfg.Hello()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("hello: URL want %s got %s", want, doxieGo.URL)
+	}
+
+	cfg.Discoverer = doxiego.FirstOf(inventory, inventory)
+
+	_, err = cfg.Hello()
+	if !errors.Is(err, errInventory) || !errors.Is(err, doxiego.ErrDoxieNotFound) {
+		t.Errorf("hello: want %v and %v got %v", errInventory, doxiego.ErrDoxieNotFound, err)
+	}
+}
+
+func TestLastKnown(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	cfg := testConfig(ts)
+
+	doxieGo, err := cfg.Dial(context.Background(), ts.URL[7:])
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cache := doxiego.NewAddressCache()
+	cache.Add(doxieGo)
+
+	doxies, err := cfg.LastKnown(cache).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(doxies) != 1 || doxies[0].MAC != doxieGo.MAC {
+		t.Errorf("last known: want scanner %s got %v", doxieGo.MAC, doxies)
+	}
+
+	// another scanner now answers at the cached address
+	cache = doxiego.NewAddressCache()
+	cache.Add(&doxiego.Doxie{MAC: "00:11:E5:FF:FF:FF", URL: doxieGo.URL})
+
+	_, err = cfg.LastKnown(cache).Discover(context.Background())
+	if !errors.Is(err, doxiego.ErrMACMismatch) {
+		t.Errorf("last known: want %v got %v", doxiego.ErrMACMismatch, err)
+	}
+}
+
+func TestHelloStaleCacheEntry(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	// a stale entry whose address accepts connections but never answers
+	stale := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer stale.Close()
+
+	cfg := testConfig(ts)
+
+	doxieGo, err := cfg.Dial(context.Background(), ts.URL[7:])
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg.Cache = doxiego.NewAddressCache()
+	cfg.Cache.Add(&doxiego.Doxie{MAC: "00:11:E5:FF:FF:FF", URL: stale.URL + "/"})
+	cfg.Cache.Add(doxieGo)
+	cfg.Discoverer = doxiego.DiscovererFunc(func(ctx context.Context) ([]*doxiego.Doxie, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+
+	got, err := cfg.HelloContext(ctx)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if got.MAC != doxieGo.MAC {
+		t.Errorf("hello: want scanner %s got %s", doxieGo.MAC, got.MAC)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hello: held up %s by a stale cache entry", elapsed)
+	}
+}
+
+func TestSubnetSweep(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	_, subnet, err := net.ParseCIDR("127.0.0.0/30")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg := testConfig(ts)
+	cfg.SweepTimeout = 100 * time.Millisecond
+
+	doxies, err := cfg.SubnetSweep(subnet).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; len(doxies) != 1 || doxies[0].URL != want {
+		t.Errorf("subnet sweep: want one scanner at %s got %v", want, doxies)
+	}
+}
+
+// loopbackInterface the name of the loopback network interface.
+func loopbackInterface(t *testing.T) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestDiscoverAllInterfaces(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	cfg := testConfig(ts)
+	cfg.SSDPAddr = startSSDPResponder(t, ssdpResponse)
+	cfg.Interfaces = []string{loopbackInterface(t)}
+
+	doxies, err := cfg.DiscoverAll(context.Background(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(doxies) != 1 || doxies[0].Interface != cfg.Interfaces[0] {
+		t.Errorf("discover all: want one scanner on %s got %v", cfg.Interfaces[0], doxies)
+	}
+}
+
+func TestDiscoverAllIPv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %s", err)
+	}
+
+	srv := startTestServer()
+	defer srv.Close()
+
+	ts := httptest.NewUnstartedServer(srv.Config.Handler)
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	// a link-local LOCATION carries a zone, which is not part of the address
+	// the response came from
+	zoned := strings.Replace(ssdpResponse, "EXT:\r\n",
+		fmt.Sprintf("EXT:\r\nLOCATION: http://[::1%%25%s]:%d/\r\n", loopbackInterface(t), port), 1)
+
+	for name, response := range map[string]string{"no location": ssdpResponse, "zoned location": zoned} {
+		t.Run(name, func(t *testing.T) {
+			responder, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			defer responder.Close()
+
+			go func() {
+				buffer := make([]byte, 1024)
+				for {
+					_, addr, err := responder.ReadFromUDP(buffer)
+					if err != nil {
+						return
+					}
+					responder.WriteToUDP([]byte(response), addr)
+				}
+			}()
+
+			cfg := &doxiego.Config{
+				Port:       port,
+				SSDPAddr6:  responder.LocalAddr().String(),
+				Interfaces: []string{loopbackInterface(t)},
+				IPv6:       true,
+			}
+
+			doxies, err := cfg.DiscoverAll(context.Background(), 200*time.Millisecond)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if want := ts.URL + "/"; len(doxies) != 1 || doxies[0].URL != want {
+				t.Errorf("discover all: want one scanner at %s got %v", want, doxies)
+			}
+		})
+	}
+}
+
+func TestAddressCachePersisted(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "scanners.json")
+
+	cache, err := doxiego.OpenAddressCache(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg := testConfig(ts)
+	cfg.Cache = cache
+
+	if _, err := cfg.Hello(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cache, err = doxiego.OpenAddressCache(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	entry, ok := cache.Lookup("00:11:E5:04:2D:6A")
+	if !ok {
+		t.Fatalf("cache: scanner %s not saved", "00:11:E5:04:2D:6A")
+	}
+
+	if entry.Name != "Doxie_042D6A" {
+		t.Errorf("cache: Name want %s got %s", "Doxie_042D6A", entry.Name)
+	}
+
+	// searching fails, so the scanner is only found at its cached address
+	cfg = &doxiego.Config{
+		APModeIP:     "127.0.0.2",
+		Port:         entry.Port,
+		SSDPAddr:     startSSDPResponder(t),
+		SearchWindow: 100 * time.Millisecond,
+		Cache:        cache,
+	}
+
+	doxieGo, err := cfg.Hello()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("hello: URL want %s got %s", want, doxieGo.URL)
+	}
+}
+
+func TestRediscover(t *testing.T) {
+	old := startTestServer()
+	ts := startTestServer()
+	defer ts.Close()
+
+	response := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nEXT:\r\nLOCATION: " + ts.URL + "/\r\nST: urn:schemas-getdoxie-com:device:Scanner:1\r\nUSN: uuid:00-11-E5-04-2D-6A\r\n\r\n"
+
+	// the scanner is only found at its new address by SSDP, and should be
+	// used as soon as it answers rather than at the end of the window
+	cfg := &doxiego.Config{
+		APModeIP:     "127.0.0.2",
+		Port:         1,
+		SSDPAddr:     startSSDPResponder(t, response),
+		SearchWindow: 5 * time.Second,
+		Rediscover:   true,
+	}
+
+	doxieGo, err := cfg.Dial(context.Background(), old.URL)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// the scanner moves to a new address
+	old.Close()
+
+	start := time.Now()
+
+	if _, err := doxieGo.Scans(); err != nil {
+		t.Fatalf("scans: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("scans: rediscovery took %s, want it to end once the scanner is found", elapsed)
+	}
+
+	if want := ts.URL + "/"; doxieGo.URL != want {
+		t.Errorf("scans: URL want %s got %s", want, doxieGo.URL)
+	}
+}
+
+func TestRediscoverNotFound(t *testing.T) {
+	old := startTestServer()
+
+	cfg := &doxiego.Config{
+		APModeIP:     "127.0.0.2",
+		Port:         1,
+		SSDPAddr:     startSSDPResponder(t),
+		SearchWindow: 100 * time.Millisecond,
+		Rediscover:   true,
+	}
+
+	doxieGo, err := cfg.Dial(context.Background(), old.URL)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	url := doxieGo.URL
+	old.Close()
+
+	_, err = doxieGo.Scans()
+	if !errors.Is(err, doxiego.ErrUnreachable) {
+		t.Errorf("scans: want %v in %v", doxiego.ErrUnreachable, err)
+	}
+
+	if doxieGo.URL != url {
+		t.Errorf("scans: URL want %s got %s", url, doxieGo.URL)
+	}
+}
+
+func TestPinnedIdentityMismatch(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	rt := &recordingTransport{}
+
+	pinned := doxiego.Identity{MAC: "00:11:E5:FF:FF:FF", Name: "Doxie_FFFFFF"}
+
+	doxieGo := doxiego.NewClient(ts.URL,
+		doxiego.WithTransport(rt),
+		doxiego.WithPinnedIdentity(pinned),
+		doxiego.WithPassword("mypassword"))
+
+	_, err := doxieGo.Scans()
+	if !errors.Is(err, doxiego.ErrIdentityMismatch) {
+		t.Fatalf("scans: want %v got %v", doxiego.ErrIdentityMismatch, err)
+	}
+
+	var idErr *doxiego.IdentityError
+	if !errors.As(err, &idErr) {
+		t.Fatalf("scans: want *doxiego.IdentityError got %T", err)
+	}
+
+	if idErr.Got.MAC != "00:11:E5:04:2D:6A" {
+		t.Errorf("scans: Got.MAC want %s got %s", "00:11:E5:04:2D:6A", idErr.Got.MAC)
+	}
+
+	for _, r := range rt.requests {
+		if _, _, ok := r.BasicAuth(); ok {
+			t.Errorf("scans: password sent to %s", r.URL.Path)
+		}
+	}
+}
+
+func TestPinnedIdentityTrustOnFirstUse(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo, err := doxiego.Dial(context.Background(), ts.URL, doxiego.WithPassword("mypassword"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := doxiego.Identity{MAC: "00:11:E5:04:2D:6A", Name: "Doxie_042D6A"}
+
+	if got, ok := doxieGo.PinnedIdentity(); !ok || got != want {
+		t.Errorf("dial: pinned identity want %v got %v", want, got)
+	}
+
+	if _, err := doxieGo.Scans(); err != nil {
+		t.Errorf("scans: %s", err)
+	}
+}
+
+func TestPinnedIdentityAddressTakenOver(t *testing.T) {
+	ts := startTestServer()
+	addr := ts.Listener.Addr().String()
+
+	doxieGo, err := doxiego.Dial(context.Background(), addr, doxiego.WithPassword("mypassword"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// the scanner leaves and another host takes over its address
+	ts.Close()
+
+	if _, err := doxieGo.Scans(); !errors.Is(err, doxiego.ErrUnreachable) {
+		t.Fatalf("scans: want %v got %v", doxiego.ErrUnreachable, err)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address %s not reusable: %s", addr, err)
+	}
+
+	var gotAuth bool
+
+	other := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			gotAuth = true
+		}
+		fmt.Fprintf(w, `{"model":"DX250","name":"Doxie_FFFFFF","MAC":"00:11:E5:FF:FF:FF"}`)
+	}))
+	other.Listener.Close()
+	other.Listener = l
+	other.Start()
+	defer other.Close()
+
+	if _, err := doxieGo.Scans(); !errors.Is(err, doxiego.ErrIdentityMismatch) {
+		t.Errorf("scans: want %v got %v", doxiego.ErrIdentityMismatch, err)
+	}
+
+	if gotAuth {
+		t.Errorf("scans: password sent to the host which took over the address")
+	}
+}
+
+func TestPinnedIdentityNewConnection(t *testing.T) {
+	srv := startTestServer()
+	defer srv.Close()
+
+	var hellos int
+
+	// a scanner which closes the connection after every response
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hello.json" {
+			hellos++
+		}
+		w.Header().Set("Connection", "close")
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	doxieGo, err := doxiego.Dial(context.Background(), ts.URL, doxiego.WithPassword("mypassword"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := doxieGo.Scans(); err != nil {
+			t.Fatalf("scans: %s", err)
+		}
+	}
+
+	// the first request follows Dial, each later one is on a new connection
+	if hellos != 3 {
+		t.Errorf("hello.json: want %d requests got %d", 3, hellos)
+	}
+}
+
+func TestPasswordBasicAuth(t *testing.T) {
+	ts := startTestServer()
+	defer func() {
+		ts.Close()
+		respFlags.passwordSet = false
+	}()
+
+	respFlags.passwordSet = true
+
+	rt := &recordingTransport{}
+
+	doxieGo, err := doxiego.Dial(context.Background(), ts.URL, doxiego.WithTransport(rt))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	_, err = doxieGo.Scans()
+	if !errors.Is(err, doxiego.ErrUnauthorized) {
+		t.Errorf("scans: want %v got %v", doxiego.ErrUnauthorized, err)
+	}
+
+	doxieGo.Password = "mypassword"
+
+	if _, err := doxieGo.Scans(); err != nil {
+		t.Fatalf("scans: %s", err)
+	}
+
+	for _, r := range rt.requests {
+		if r.URL.User != nil {
+			t.Errorf("scans: credentials in URL %s", r.URL.Redacted())
+		}
+	}
+}
+
+func TestHelloClientFields(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hello.json":
+			fmt.Fprintf(w, `{ "model": "DX250", "name": "Doxie_062400",
+				"MAC": "00:11:E5:06:24:00", "mode": "AP", "hasPassword": true,
+				"URL": "http://192.0.2.1/", "password": "stolen" }`)
+		case "/scans.json":
+			if _, pass, ok := r.BasicAuth(); !ok || pass != "mypassword" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	doxieGo, err := doxiego.Dial(context.Background(), ts.URL, doxiego.WithPassword("mypassword"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if doxieGo.URL != ts.URL+"/" {
+		t.Errorf("url: want %s got %s", ts.URL+"/", doxieGo.URL)
+	}
+
+	if doxieGo.Password != "mypassword" {
+		t.Errorf("password: overwritten by hello.json")
+	}
+
+	if _, err := doxieGo.Scans(); err != nil {
+		t.Errorf("scans: %s", err)
+	}
+}
+
+func TestPasswordRequired(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	rt := &recordingTransport{}
+
+	doxieGo := doxiego.NewClient(ts.URL, doxiego.WithTransport(rt))
+	doxieGo.HasPassword = true
+
+	_, err := doxieGo.Scans()
+	if err != doxiego.ErrPasswordRequired {
+		t.Errorf("scans: want %v got %v", doxiego.ErrPasswordRequired, err)
+	}
+
+	if len(rt.requests) != 0 {
+		t.Errorf("scans: requests want %d got %d", 0, len(rt.requests))
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	body, info, err := doxieGo.ScanReader(context.Background(), "img_001.jpg")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !bytes.Equal(data, testScan) {
+		t.Errorf("scan reader: scan bytes changed")
+	}
+
+	if info.Name != "IMG_001.JPG" {
+		t.Errorf("scan reader: Name want %s got %s", "IMG_001.JPG", info.Name)
+	} else if info.Size != int64(len(testScan)) {
+		t.Errorf("scan reader: Size want %d got %d", len(testScan), info.Size)
+	} else if info.ContentType != "image/jpeg" {
+		t.Errorf("scan reader: ContentType want %s got %s", "image/jpeg", info.ContentType)
+	}
+
+	if _, _, err := doxieGo.ScanReader(context.Background(), "img_999.jpg"); !errors.Is(err, doxiego.ErrScanNotFound) || !errors.Is(err, doxiego.ErrNotFound) {
+		t.Errorf("scan reader: want %v got %v", doxiego.ErrScanNotFound, err)
+	}
+}
+
+func TestDownloadTo(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	var buf bytes.Buffer
+
+	n, err := doxiego.NewClient(ts.URL).DownloadTo(context.Background(), "img_001.jpg", &buf)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if n != int64(len(testScan)) || !bytes.Equal(buf.Bytes(), testScan) {
+		t.Errorf("download to: want %d unchanged bytes got %d", len(testScan), n)
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	var updates []doxiego.Progress
+
+	doxieGo := doxiego.NewClient(ts.URL, doxiego.WithProgress(func(p doxiego.Progress) {
+		updates = append(updates, p)
+	}))
+
+	if _, err := doxieGo.DownloadTo(context.Background(), "img_001.jpg", ioutil.Discard); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(updates) == 0 {
+		t.Fatalf("progress: no updates")
+	}
+
+	want := doxiego.Progress{Name: "IMG_001.JPG", Received: int64(len(testScan)), Total: int64(len(testScan))}
+
+	if got := updates[len(updates)-1]; got != want {
+		t.Errorf("progress: last update want %+v got %+v", want, got)
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	rt := &recordingTransport{}
+
+	path := filepath.Join(t.TempDir(), "IMG_002.JPG")
+
+	// an interrupted download
+	if err := ioutil.WriteFile(path+".part", testScan[:100], 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	doxieGo := doxiego.NewClient(ts.URL, doxiego.WithTransport(rt))
+
+	item := doxiego.ScanItem{Name: "IMG_002.JPG", Size: len(testScan)}
+
+	dl, err := doxieGo.DownloadFile(context.Background(), item, path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if dl.Size != int64(len(testScan)) || !bytes.Equal(data, testScan) {
+		t.Errorf("download file: want %d unchanged bytes got %d", len(testScan), dl.Size)
+	}
+
+	if want := fmt.Sprintf("%x", sha256.Sum256(testScan)); dl.SHA256 != want {
+		t.Errorf("download file: SHA256 want %s got %s", want, dl.SHA256)
+	}
+
+	if len(rt.requests) != 1 {
+		t.Fatalf("download file: requests want %d got %d", 1, len(rt.requests))
+	}
+
+	if got := rt.requests[0].Header.Get("Range"); got != "bytes=100-" {
+		t.Errorf("download file: Range want %s got %s", "bytes=100-", got)
+	}
+}
+
+func TestDownloadFileRestart(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "IMG_001.JPG")
+
+	// the scanner ignores Range, so the part file is replaced
+	if err := ioutil.WriteFile(path+".part", []byte("partial"), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	item := doxiego.ScanItem{Name: "IMG_001.JPG", Size: len(testScan)}
+
+	if _, err := doxiego.NewClient(ts.URL).DownloadFile(context.Background(), item, path); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !bytes.Equal(data, testScan) {
+		t.Errorf("download file: scan bytes changed")
+	}
+}
+
+func TestDownloadFileSizeMismatch(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "IMG_001.JPG")
+
+	item := doxiego.ScanItem{Name: "IMG_001.JPG", Size: 2 * len(testScan)}
+
+	doxieGo := doxiego.NewClient(ts.URL, doxiego.WithDownloadRetries(1))
+
+	_, err := doxieGo.DownloadFile(context.Background(), item, path)
+	if !errors.Is(err, doxiego.ErrIncompleteDownload) {
+		t.Errorf("download file: want %v got %v", doxiego.ErrIncompleteDownload, err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("download file: %s should not exist", path)
+	}
+}
+
+func TestDownloadFileRenameFails(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	// a non-empty directory in the way of the finished download
+	path := filepath.Join(t.TempDir(), "IMG_001.JPG")
+	if err := os.MkdirAll(filepath.Join(path, "keep"), 0755); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	item := doxiego.ScanItem{Name: "IMG_001.JPG", Size: len(testScan)}
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	dl, err := doxieGo.DownloadFile(context.Background(), item, path)
+	if err == nil || dl != nil {
+		t.Errorf("download file: want nil download and an error got %v, %v", dl, err)
+	}
+}
+
+func TestDownloadToTruncated(t *testing.T) {
+	// the transfer is cut short of the Content-Length the scanner sent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(testScan)))
+		w.Write(testScan[:len(testScan)/2])
+	}))
+	defer ts.Close()
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	var buf bytes.Buffer
+
+	if _, err := doxieGo.DownloadTo(context.Background(), "IMG_001.JPG", &buf); !errors.Is(err, doxiego.ErrIncompleteDownload) {
+		t.Errorf("download to: want %v got %v", doxiego.ErrIncompleteDownload, err)
+	}
+
+	if _, err := doxieGo.Scan("IMG_001.JPG"); !errors.Is(err, doxiego.ErrIncompleteDownload) {
+		t.Errorf("scan: want %v got %v", doxiego.ErrIncompleteDownload, err)
+	}
+}
+
+func TestDownloadFileRetriesTruncated(t *testing.T) {
+	var requests int
+
+	// the first transfer is cut short, the scanner honours Range after
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(testScan)))
+			w.Write(testScan[:len(testScan)/2])
+			return
+		}
+		http.ServeContent(w, r, "IMG_001.JPG", time.Time{}, bytes.NewReader(testScan))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "IMG_001.JPG")
+
+	item := doxiego.ScanItem{Name: "IMG_001.JPG", Size: len(testScan)}
+
+	if _, err := doxiego.NewClient(ts.URL).DownloadFile(context.Background(), item, path); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !bytes.Equal(data, testScan) {
+		t.Errorf("download file: scan bytes changed")
+	}
+
+	if requests != 2 {
+		t.Errorf("download file: requests want %d got %d", 2, requests)
+	}
+}
+
+func TestDownloadToVerifiesJPEG(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(testScan[:len(testScan)-2])
+	}))
+	defer ts.Close()
+
+	_, err := doxiego.NewClient(ts.URL).DownloadTo(context.Background(), "img_001.jpg", ioutil.Discard)
+	if !errors.Is(err, doxiego.ErrIncompleteDownload) {
+		t.Errorf("download to: want %v got %v", doxiego.ErrIncompleteDownload, err)
+	}
+}
+
+func TestEstimateClockDrift(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	items, err := doxieGo.Scans()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := time.Date(2010, 5, 1, 0, 9, 44, 0, time.UTC)
+
+	if got := items[2].ModifiedTime; !got.Equal(want) {
+		t.Errorf("scans: ModifiedTime want %s got %s", want, got)
+	} else if !items[2].Scanned.Equal(want) {
+		t.Errorf("scans: Scanned want %s got %s", want, items[2].Scanned)
+	}
+
+	drift, err := doxieGo.EstimateClockDrift(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if drift != doxieGo.ClockDrift() {
+		t.Errorf("clock drift: want %s got %s", drift, doxieGo.ClockDrift())
+	}
+
+	items, err = doxieGo.Scans()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// the most recent scan was made just now
+	if d := time.Since(items[2].Scanned); d < -time.Minute || d > time.Minute {
+		t.Errorf("scans: Scanned want about now got %s", items[2].Scanned)
+	}
+}
+
+func TestEstimateClockDriftNoRecent(t *testing.T) {
+	ts := startTestServer()
+	defer func() {
+		ts.Close()
+		respFlags.noRecent = false
+	}()
+
+	respFlags.noRecent = true
+
+	_, err := doxiego.NewClient(ts.URL).EstimateClockDrift(context.Background())
+	if err != doxiego.ErrNoRecentScan {
+		t.Errorf("clock drift: want %v got %v", doxiego.ErrNoRecentScan, err)
+	}
+}
+
+func TestRecentPath(t *testing.T) {
+	srv := startTestServer()
+	defer srv.Close()
+
+	// the recent scan shares its name with one in another folder
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/scans/recent.json":
+			fmt.Fprintf(w, `{"path":"/DOXIE/JPEG_2/img_0004.jpg"}`)
+		case "/scans.json":
+			fmt.Fprintf(w, `[{"name":"/DOXIE/JPEG/img_0004.jpg","size":10,"modified":"2010-05-01 00:01:00"},
+				{"name":"/DOXIE/JPEG_2/img_0004.jpg","size":10,"modified":"2010-05-01 00:09:44"}]`)
+		default:
+			srv.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	recent, err := doxieGo.RecentPath()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := "/DOXIE/JPEG_2/img_0004.jpg"; recent != want {
+		t.Errorf("recent path: want %s got %s", want, recent)
+	}
+
+	if _, err := doxieGo.Scan(recent); err != nil {
+		t.Errorf("scan: %s", err)
+	}
+
+	want := time.Since(time.Date(2010, 5, 1, 0, 9, 44, 0, time.UTC))
+
+	drift, err := doxieGo.EstimateClockDrift(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if d := drift - want; d < -time.Minute || d > time.Minute {
+		t.Errorf("clock drift: want about %s got %s", want, drift)
+	}
+}
+
+func TestScanByPath(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	items, err := doxieGo.Scans()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := "/DOXIE/JPEG/IMG_0001.JPG"; items[0].Path != want {
+		t.Errorf("scans: Path want %s got %s", want, items[0].Path)
+	} else if items[0].Name != "IMG_0001.JPG" {
+		t.Errorf("scans: Name want %s got %s", "IMG_0001.JPG", items[0].Name)
+	}
+
+	body, info, err := doxieGo.ScanReader(context.Background(), "/DOXIE/JPEG_2/img_0004.jpg")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	body.Close()
+
+	if info.Name != "img_0004.jpg" {
+		t.Errorf("scan reader: Name want %s got %s", "img_0004.jpg", info.Name)
+	}
+
+	// a bare name is looked for in /DOXIE/JPEG/
+	if _, err := doxieGo.Scan("img_001.jpg"); err != nil {
+		t.Errorf("scan: %s", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	caps := doxiego.NewClient(ts.URL).Capabilities()
+	if caps.Model != "DX250" || !caps.Thumbnails || len(caps.FileTypes) != 1 {
+		t.Errorf("capabilities: want DX250 defaults got %+v", caps)
+	}
+
+	// a later firmware which drops restart
+	restricted := caps
+	restricted.Restart = false
+
+	table := doxiego.DefaultCapabilities()
+	table.Register("DXTEST", "2.0", restricted)
+	table.Register("DXTEST", "", caps)
+
+	doxieGo, err := testConfig(ts).Hello()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	doxieGo.Model = "DXTEST"
+	doxieGo.FirmwareWiFi = "2.10"
+
+	// the table only applies to a Doxie it is given to
+	if !doxieGo.Capabilities().Restart {
+		t.Errorf("capabilities: built-in table should not know %s", doxieGo.Model)
+	}
+
+	doxieGo = doxiego.NewClient(ts.URL, doxiego.WithCapabilities(table))
+	doxieGo.Model = "DXTEST"
+
+	doxieGo.FirmwareWiFi = "1.9"
+	if !doxieGo.Capabilities().Restart {
+		t.Errorf("capabilities: firmware %s should support restart", doxieGo.FirmwareWiFi)
+	}
+
+	doxieGo.FirmwareWiFi = "2.10"
+	if doxieGo.Capabilities().Restart {
+		t.Errorf("capabilities: firmware %s should not support restart", doxieGo.FirmwareWiFi)
+	}
+
+	if err := doxieGo.Restart(); !errors.Is(err, doxiego.ErrUnsupported) {
+		t.Errorf("restart: want %v got %v", doxiego.ErrUnsupported, err)
+	}
+}
+
+func TestCapabilitiesScanFolders(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	rt := &recordingTransport{}
+
+	// a model which also saves PDFs, in their own folder
+	caps, _ := doxiego.DefaultCapabilities().Lookup("DX250", "")
+	caps.FileTypes = append(caps.FileTypes, "application/pdf")
+	caps.Folders[".PDF"] = "/DOXIE/PDF/"
+
+	table := doxiego.DefaultCapabilities()
+	table.Register("DXPDF", "", caps)
+
+	doxieGo := doxiego.NewClient(ts.URL, doxiego.WithTransport(rt), doxiego.WithCapabilities(table))
+	doxieGo.Model = "DXPDF"
+
+	doxieGo.ScanReader(context.Background(), "doc_0001.pdf")
+	doxieGo.ScanReader(context.Background(), "img_0001.jpg")
+
+	want := []string{"/scans/DOXIE/PDF/DOC_0001.PDF", "/scans/DOXIE/JPEG/IMG_0001.JPG"}
+
+	if len(rt.requests) != len(want) {
+		t.Fatalf("scan reader: requests want %d got %d", len(want), len(rt.requests))
+	}
+
+	for idx, r := range rt.requests {
+		if r.URL.Path != want[idx] {
+			t.Errorf("scan reader: path want %s got %s", want[idx], r.URL.Path)
+		}
+	}
+
+	// unknown models are like the DX250, which only saves JPEGs
+	doxieGo = doxiego.NewClient(ts.URL, doxiego.WithTransport(rt))
+	doxieGo.Model = "DX400"
+
+	if _, _, err := doxieGo.ScanReader(context.Background(), "doc_0001.pdf"); !errors.Is(err, doxiego.ErrUnsupported) {
+		t.Errorf("scan reader: want %v got %v", doxiego.ErrUnsupported, err)
+	}
+
+	if len(rt.requests) != len(want) {
+		t.Errorf("scan reader: unsupported file type requested from the scanner")
+	}
+}
+
+func TestScanContentTypes(t *testing.T) {
+	ts := startTestServer()
+	defer ts.Close()
+
+	doxieGo := doxiego.NewClient(ts.URL)
+
+	img, err := doxieGo.Scan("img_0005.jpg")
+	if err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 2 {
+		t.Errorf("scan: bounds want 2x2 got %v", b)
+	}
+
+	_, err = doxieGo.Scan("/DOXIE/PDF/DOC_0001.PDF")
+	if !errors.Is(err, doxiego.ErrNotImage) {
+		t.Errorf("scan: want %v got %v", doxiego.ErrNotImage, err)
+	}
+
+	doc, err := doxieGo.ScanDocument(context.Background(), "/DOXIE/PDF/DOC_0001.PDF")
+	if err != nil {
+		t.Fatalf("scan document: %s", err)
+	}
+
+	if doc.ContentType != "application/pdf" {
+		t.Errorf("scan document: ContentType want %s got %s", "application/pdf", doc.ContentType)
+	} else if doc.Ext() != ".pdf" {
+		t.Errorf("scan document: Ext want %s got %s", ".pdf", doc.Ext())
+	} else if !bytes.Equal(doc.Data, testPDF) {
+		t.Errorf("scan document: document bytes changed")
+	}
+}
+
+func TestLenientDecoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hello.json":
+			fmt.Fprint(w, `{"model":"DX250","name":42,"firmwareWiFi":1.29,"hasPassword":"true","MAC":"00:11:E5:04:2D:6A","battery":{"level":80},"URL":"http://192.0.2.1/","password":"x"}`)
+		case "/scans.json":
+			fmt.Fprint(w, `[{"name":"/DOXIE/JPEG/IMG_0001.JPG","size":"241220","modified":"2010-05-01 00:10:06","pages":2,"path":"/elsewhere"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dox, err := doxiego.Dial(context.Background(), ts.URL, doxiego.WithPassword("secret"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if dox.FirmwareWiFi != "1.29" {
+		t.Errorf("doxie: FirmwareWiFi want %s got %s", "1.29", dox.FirmwareWiFi)
+	} else if dox.Name != "42" {
+		t.Errorf("doxie: Name want %s got %s", "42", dox.Name)
+	} else if !dox.HasPassword {
+		t.Errorf("doxie: HasPassword want %t got %t", true, dox.HasPassword)
+	} else if dox.MAC != "00:11:E5:04:2D:6A" {
+		t.Errorf("doxie: MAC want %s got %s", "00:11:E5:04:2D:6A", dox.MAC)
+	}
+
+	if got := string(dox.Extra["battery"]); got != `{"level":80}` {
+		t.Errorf("doxie: Extra battery want %s got %s", `{"level":80}`, got)
+	}
+
+	// client side fields are never taken from the scanner
+	if dox.URL != ts.URL+"/" || dox.Password != "secret" {
+		t.Errorf("doxie: URL and Password set from hello.json, %q %q", dox.URL, dox.Password)
+	}
+
+	if dox.Extra["URL"] == nil || dox.Extra["password"] == nil {
+		t.Errorf("doxie: URL and password want in Extra got %v", dox.Extra)
+	}
+
+	// the identity check decodes hello.json the same way before sending the
+	// password
+	dox = doxiego.NewClient(ts.URL+"/",
+		doxiego.WithPassword("secret"),
+		doxiego.WithPinnedIdentity(doxiego.Identity{MAC: "00:11:E5:04:2D:6A", Name: "42"}))
+
+	items, err := dox.Scans()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if items[0].Size != 241220 {
+		t.Errorf("scan item: Size want %d got %d", 241220, items[0].Size)
+	}
+
+	if got := string(items[0].Extra["pages"]); got != "2" {
+		t.Errorf("scan item: Extra pages want %s got %s", "2", got)
+	}
+
+	// Path is set by the client, not the scanner
+	if items[0].Path != "/DOXIE/JPEG/IMG_0001.JPG" || items[0].Extra["path"] == nil {
+		t.Errorf("scan item: path want in Extra got Path %q", items[0].Path)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	// decoding from the scanner is lenient, but encoding/json still treats the
+	// public types as plain structs
+	dox := doxiego.Doxie{URL: "http://192.0.2.1:8080/", Password: "secret", Name: "Doxie_042D6A"}
+
+	data, err := json.Marshal(dox)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var gotDox doxiego.Doxie
+	if err := json.Unmarshal(data, &gotDox); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if gotDox.URL != dox.URL || gotDox.Password != dox.Password || gotDox.Name != dox.Name {
+		t.Errorf("doxie: want %q %q %q got %q %q %q", dox.URL, dox.Password, dox.Name, gotDox.URL, gotDox.Password, gotDox.Name)
+	}
+
+	item := doxiego.ScanItem{
+		Name:         "IMG_0001.JPG",
+		Path:         "/DOXIE/JPEG/IMG_0001.JPG",
+		ModifiedTime: time.Date(2010, 5, 1, 0, 10, 6, 0, time.UTC),
+	}
+
+	data, err = json.Marshal(item)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var gotItem doxiego.ScanItem
+	if err := json.Unmarshal(data, &gotItem); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if gotItem.Path != item.Path || !gotItem.ModifiedTime.Equal(item.ModifiedTime) {
+		t.Errorf("scan item: want %q %s got %q %s", item.Path, item.ModifiedTime, gotItem.Path, gotItem.ModifiedTime)
+	}
+}
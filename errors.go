@@ -0,0 +1,185 @@
+package doxiego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxErrorBody the number of bytes of a response body kept in an HTTPError
+const maxErrorBody = 128
+
+var (
+	// ErrUnauthorized the scanner rejected the request, the password is
+	// missing or wrong
+	ErrUnauthorized = errors.New("doxie: unauthorized")
+	// ErrPasswordRequired the scanner has a password but Doxie.Password is
+	// not set, the request was not sent
+	ErrPasswordRequired = errors.New("doxie: scanner requires a password")
+	// ErrBusy the scanner is busy and cannot serve the request right now
+	ErrBusy = errors.New("doxie: scanner busy")
+	// ErrNotFound the requested endpoint or scan does not exist on the scanner
+	ErrNotFound = errors.New("doxie: not found")
+	// ErrTimeout the scanner did not answer in time
+	ErrTimeout = errors.New("doxie: request timed out")
+	// ErrUnreachable the scanner could not be connected to
+	ErrUnreachable = errors.New("doxie: scanner unreachable")
+	// ErrIdentityMismatch the scanner does not report the pinned identity, so
+	// the password was not sent to it
+	ErrIdentityMismatch = errors.New("doxie: scanner identity does not match pinned identity")
+)
+
+// HTTPError is returned when the scanner answers a request with an unexpected
+// status code. Use errors.Is with ErrUnauthorized, ErrBusy or ErrNotFound to
+// check the class of failure.
+type HTTPError struct {
+	// StatusCode returned by the scanner
+	StatusCode int
+	// Endpoint requested, relative to the scanners URL e.g. "scans.json"
+	Endpoint string
+	// Body the start of the response body, if any
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	msg := "doxie: request error http " + strconv.Itoa(e.StatusCode) + " " + e.Endpoint
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Is reports whether the status code of e falls in the class of target.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrHTTPRequest:
+		return true
+	case ErrUnauthorized:
+		// the scanner answers 403 when deleting scans which do not exist, so
+		// only 401 means the password is missing or wrong
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrBusy:
+		return e.StatusCode == http.StatusServiceUnavailable ||
+			e.StatusCode == http.StatusConflict ||
+			e.StatusCode == http.StatusLocked
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// NetError is returned when a request could not be completed because the
+// scanner did not answer in time or could not be reached. It matches
+// ErrDoxieNotFound and one of ErrTimeout or ErrUnreachable with errors.Is.
+type NetError struct {
+	// Endpoint requested, relative to the scanners URL e.g. "scans.json"
+	Endpoint string
+	// Err the underlying transport error
+	Err error
+
+	timeout bool
+}
+
+func (e *NetError) Error() string {
+	if e.timeout {
+		return "doxie: " + e.Endpoint + ": " + ErrTimeout.Error()
+	}
+	return "doxie: " + e.Endpoint + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying transport error.
+func (e *NetError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the scanner failed to answer in time.
+func (e *NetError) Timeout() bool {
+	return e.timeout
+}
+
+// Is reports whether target is ErrDoxieNotFound, or the ErrTimeout or
+// ErrUnreachable class of e.
+func (e *NetError) Is(target error) bool {
+	switch target {
+	case ErrDoxieNotFound:
+		return true
+	case ErrTimeout:
+		return e.timeout
+	case ErrUnreachable:
+		return !e.timeout
+	}
+	return false
+}
+
+// DiscoveryError is returned by Hello when every strategy used to search for
+// the scanner failed. It matches ErrDoxieNotFound with errors.Is, and the
+// errors of each strategy with errors.Is and errors.As.
+type DiscoveryError struct {
+	// Errs why each strategy failed, prefixed with the strategy name
+	Errs []error
+}
+
+func (e *DiscoveryError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for idx, err := range e.Errs {
+		msgs[idx] = err.Error()
+	}
+	return ErrDoxieNotFound.Error() + " (" + strings.Join(msgs, "; ") + ")"
+}
+
+// Unwrap returns the errors of each strategy.
+func (e *DiscoveryError) Unwrap() []error {
+	return e.Errs
+}
+
+// Is reports whether target is ErrDoxieNotFound.
+func (e *DiscoveryError) Is(target error) bool {
+	return target == ErrDoxieNotFound
+}
+
+// IdentityError is returned instead of sending the password to a scanner
+// whose hello.json does not report the pinned identity. It matches
+// ErrIdentityMismatch with errors.Is.
+type IdentityError struct {
+	// URL of the scanner which reported Got
+	URL string
+	// Pinned identity the password may be sent to
+	Pinned Identity
+	// Got identity reported by the scanner
+	Got Identity
+}
+
+func (e *IdentityError) Error() string {
+	return ErrIdentityMismatch.Error() + ": " + e.URL + " is " + e.Got.Name + " " + e.Got.MAC +
+		", want " + e.Pinned.Name + " " + e.Pinned.MAC
+}
+
+// Is reports whether target is ErrIdentityMismatch.
+func (e *IdentityError) Is(target error) bool {
+	return target == ErrIdentityMismatch
+}
+
+// httpError returns an HTTPError describing r.
+func (r *response) httpError() error {
+	body := r.data
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+	return &HTTPError{
+		StatusCode: r.statusCode,
+		Endpoint:   r.endpoint,
+		Body:       string(body),
+	}
+}
+
+// newNetError returns a NetError for a request to endpoint which failed with
+// err. reqCtx is the context the request was made with.
+func newNetError(reqCtx context.Context, endpoint string, err error) error {
+	timeout := errors.Is(err, context.DeadlineExceeded) || reqCtx.Err() == context.DeadlineExceeded
+	if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+		timeout = true
+	}
+	return &NetError{Endpoint: endpoint, Err: err, timeout: timeout}
+}
@@ -0,0 +1,117 @@
+package doxiego
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Identity the MAC address and name a scanner reports in hello.json.
+type Identity struct {
+	// MAC address of the scanner
+	MAC string
+	// Name of the scanner
+	Name string
+}
+
+// identityPin the identity a Doxie sends its password to, and the last URL it
+// was confirmed at.
+type identityPin struct {
+	mu       sync.Mutex
+	pinned   *Identity
+	verified string
+}
+
+// WithPinnedIdentity only sends the password to a scanner which reports id in
+// hello.json. Without it a Doxie pins the identity reported the first time it
+// says hello, trust on first use.
+func WithPinnedIdentity(id Identity) Option {
+	return func(d *Doxie) {
+		d.identity = &identityPin{pinned: &id}
+	}
+}
+
+// PinnedIdentity returns the identity the password is sent to, and false if
+// none has been pinned yet. Save it and pass it to WithPinnedIdentity to keep
+// trusting the same scanner across runs.
+func (d *Doxie) PinnedIdentity() (Identity, bool) {
+	if d.identity == nil {
+		return Identity{}, false
+	}
+
+	d.identity.mu.Lock()
+	defer d.identity.mu.Unlock()
+
+	if d.identity.pinned == nil {
+		return Identity{}, false
+	}
+	return *d.identity.pinned, true
+}
+
+// pin records id as seen at base, pinning it if nothing is pinned yet. It
+// returns an IdentityError if id is not the pinned identity.
+func (p *identityPin) pin(base string, id Identity) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pinned == nil {
+		p.pinned = &id
+	}
+
+	if *p.pinned != id {
+		p.verified = ""
+		return &IdentityError{URL: base, Pinned: *p.pinned, Got: id}
+	}
+
+	p.verified = base
+	return nil
+}
+
+// isVerified reports whether the pinned identity was last confirmed at base.
+func (p *identityPin) isVerified(base string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.verified != "" && p.verified == base
+}
+
+// forget drops the confirmation of the pinned identity at base, so it is
+// checked again before the password is next sent there.
+func (p *identityPin) forget(base string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.verified == base {
+		p.verified = ""
+	}
+}
+
+// verifyIdentity checks the scanner at base reports the pinned identity before
+// the password is sent to it. The check is made again whenever a request to
+// base fails to reach it or opens a new connection, as another host may have
+// taken over the address.
+func (d *Doxie) verifyIdentity(ctx context.Context, base string) error {
+	if d.identity == nil || d.identity.isVerified(base) {
+		return nil
+	}
+
+	resp, err := d.send(ctx, base, http.MethodGet, "hello.json", false, false, nil, nil)
+	r := readResponse("hello.json", resp, err)
+
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.statusCode != http.StatusOK {
+		return r.httpError()
+	}
+
+	var id Identity
+
+	err = decodeLenient(r.data, &id, identityFields)
+	if err != nil {
+		return err
+	}
+
+	return d.identity.pin(base, id)
+}
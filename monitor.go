@@ -0,0 +1,284 @@
+package doxiego
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultMaxAge how long a scanner is considered present when its
+// advertisement does not say.
+const defaultMaxAge = 30 * time.Minute
+
+// EventType the kind of presence change reported by a Monitor.
+type EventType int
+
+const (
+	// ScannerAlive a scanner announced itself or answered a search
+	ScannerAlive EventType = iota
+	// ScannerByeBye a scanner announced it is leaving the network, or its
+	// advertisement expired without being renewed
+	ScannerByeBye
+)
+
+func (t EventType) String() string {
+	switch t {
+	case ScannerAlive:
+		return "alive"
+	case ScannerByeBye:
+		return "byebye"
+	}
+	return "unknown"
+}
+
+// Event a change in the presence of a scanner seen by a Monitor.
+type Event struct {
+	// Type of presence change
+	Type EventType
+	// USN unique service name of the scanner
+	USN string
+	// Location advertised by the scanner, may be empty for ScannerByeBye
+	Location string
+	// Server product string of the scanner
+	Server string
+	// MaxAge time the advertisement is valid for
+	MaxAge time.Duration
+	// IP the announcement was received from
+	IP net.IP
+	// URL of the scanner API, use Dial to connect to it
+	URL string
+}
+
+// Monitor passively watches the network for scanners announcing themselves or
+// leaving, using SSDP NOTIFY messages and periodic searches.
+type Monitor struct {
+	events chan Event
+	listen *net.UDPConn
+	search *net.UDPConn
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// ssdpPacket a parsed datagram received by a Monitor.
+type ssdpPacket struct {
+	r      *ssdpResponse
+	byebye bool
+}
+
+// NewMonitor joins the SSDP multicast group and reports scanners joining and
+// leaving the network until ctx is done or the Monitor is closed. A search is
+// sent every searchInterval, or only once if searchInterval is zero.
+func NewMonitor(ctx context.Context, searchInterval time.Duration) (*Monitor, error) {
+	return DefaultConfig().Monitor(ctx, searchInterval)
+}
+
+// Monitor is like NewMonitor but uses the SSDP address and port in c. It joins
+// the IPv4 group on the interface the kernel picks, Interfaces, AllInterfaces
+// and IPv6 are not used.
+func (c *Config) Monitor(ctx context.Context, searchInterval time.Duration) (*Monitor, error) {
+	groupAddr, err := net.ResolveUDPAddr("udp4", c.ssdpAddr())
+	if err != nil {
+		return nil, err
+	}
+
+	var listen *net.UDPConn
+	if groupAddr.IP.IsMulticast() {
+		listen, err = net.ListenMulticastUDP("udp4", nil, groupAddr)
+	} else {
+		listen, err = net.ListenUDP("udp4", groupAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	search, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		listen.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	m := &Monitor{
+		events: make(chan Event),
+		listen: listen,
+		search: search,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go m.run(ctx, c, groupAddr, searchInterval)
+
+	return m, nil
+}
+
+// Events returns the channel events are delivered on, it is closed once the
+// Monitor stops.
+func (m *Monitor) Events() <-chan Event {
+	return m.events
+}
+
+// Close stops the Monitor and leaves the multicast group.
+func (m *Monitor) Close() error {
+	m.once.Do(m.cancel)
+	<-m.done
+	return nil
+}
+
+// run tracks which scanners are present until ctx is done.
+func (m *Monitor) run(ctx context.Context, c *Config, groupAddr *net.UDPAddr, searchInterval time.Duration) {
+	defer close(m.done)
+	defer close(m.events)
+	defer m.listen.Close()
+	defer m.search.Close()
+
+	packets := make(chan ssdpPacket)
+
+	go m.read(ctx, m.listen, parseSSDPNotify, packets)
+	go m.read(ctx, m.search, func(data []byte, addr *net.UDPAddr) (*ssdpResponse, bool, error) {
+		r, err := parseSSDPResponse(data, addr)
+		return r, false, err
+	}, packets)
+
+	m.search.WriteTo([]byte(ssdpDiscover), groupAddr)
+	lastSearch := time.Now()
+
+	// scanners present, keyed by USN, and when their advertisement expires.
+	present := make(map[string]Event)
+	expires := make(map[string]time.Time)
+
+	emit := func(e Event) bool {
+		select {
+		case m.events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-packets:
+			e := Event{
+				Type:     ScannerAlive,
+				USN:      p.r.USN,
+				Location: p.r.Location,
+				Server:   p.r.Server,
+				MaxAge:   p.r.MaxAge,
+				IP:       p.r.Addr.IP,
+			}
+			if e.Location != "" || !p.byebye {
+				e.URL = p.r.baseURL(c.port())
+			}
+
+			key := e.USN
+			if key == "" {
+				key = e.IP.String()
+			}
+
+			if p.byebye {
+				e.Type = ScannerByeBye
+				delete(present, key)
+				delete(expires, key)
+				if !emit(e) {
+					return
+				}
+				continue
+			}
+
+			maxAge := e.MaxAge
+			if maxAge <= 0 {
+				maxAge = defaultMaxAge
+			}
+			expires[key] = time.Now().Add(maxAge)
+
+			if _, ok := present[key]; ok {
+				continue
+			}
+			present[key] = e
+			if !emit(e) {
+				return
+			}
+		case now := <-ticker.C:
+			for key, expiry := range expires {
+				if now.Before(expiry) {
+					continue
+				}
+				e := present[key]
+				e.Type = ScannerByeBye
+				delete(present, key)
+				delete(expires, key)
+				if !emit(e) {
+					return
+				}
+			}
+
+			if searchInterval > 0 && now.Sub(lastSearch) >= searchInterval {
+				m.search.WriteTo([]byte(ssdpDiscover), groupAddr)
+				lastSearch = now
+			}
+		}
+	}
+}
+
+// read parses datagrams from conn and delivers those from Doxie scanners to
+// packets until conn is closed.
+func (m *Monitor) read(ctx context.Context, conn *net.UDPConn, parse func([]byte, *net.UDPAddr) (*ssdpResponse, bool, error), packets chan<- ssdpPacket) {
+	buffer := make([]byte, 2048)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		r, byebye, err := parse(buffer[:n], addr)
+		if err != nil {
+			continue
+		}
+
+		select {
+		case packets <- ssdpPacket{r: r, byebye: byebye}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseSSDPNotify parses the SSDP NOTIFY announcement in data, sent from addr,
+// reporting whether the scanner is leaving the network.
+func parseSSDPNotify(data []byte, addr *net.UDPAddr) (*ssdpResponse, bool, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Body.Close()
+
+	if req.Method != "NOTIFY" {
+		return nil, false, errSSDPResponse
+	}
+
+	r, err := newSSDPResponse(req.Header, req.Header.Get("NT"), addr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch req.Header.Get("NTS") {
+	case "ssdp:alive":
+		return r, false, nil
+	case "ssdp:byebye":
+		return r, true, nil
+	}
+
+	return nil, false, errSSDPResponse
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+
+package doxiego
+
+import "net"
+
+// setMulticastInterface is not supported on this platform, the kernel picks
+// the interface multicast leaves through.
+func setMulticastInterface(conn *net.UDPConn, ip net.IP) error {
+	return nil
+}
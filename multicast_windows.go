@@ -0,0 +1,27 @@
+package doxiego
+
+import (
+	"net"
+	"syscall"
+)
+
+// setMulticastInterface makes IPv4 multicast sent on conn leave through the
+// interface owning ip.
+func setMulticastInterface(conn *net.UDPConn, ip net.IP) error {
+	var addr [4]byte
+	copy(addr[:], ip.To4())
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInet4Addr(syscall.Handle(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, addr)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
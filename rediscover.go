@@ -0,0 +1,176 @@
+package doxiego
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// rediscovery searches for a scanner again when it cannot be reached.
+type rediscovery struct {
+	mu     sync.Mutex
+	config *Config
+}
+
+// WithRediscovery makes a Doxie search for its scanner again, by MAC address
+// using cfg, when a request cannot reach it. If the scanner is found its URL is
+// updated and the request retried once. This lets a Doxie follow a scanner in
+// Client mode which was given a new address by DHCP.
+func WithRediscovery(cfg *Config) Option {
+	return func(d *Doxie) {
+		d.rediscovery = &rediscovery{config: cfg}
+	}
+}
+
+// Find searches for the scanner with the MAC address in AP mode, using SSDP,
+// the Discoverer, the Cache and, if Sweep is set, a subnet sweep, all in
+// parallel. It returns as soon as one of them finds the scanner, cancelling the
+// rest.
+func (c *Config) Find(ctx context.Context, mac string) (*Doxie, error) {
+	ds := []Discoverer{matchMAC(c.APMode(), mac), c.ssdpFind(mac)}
+
+	if c.Discoverer != nil {
+		ds = append(ds, matchMAC(c.Discoverer, mac))
+	}
+
+	if c.Cache != nil {
+		for _, d := range c.lastKnown(c.Cache) {
+			ds = append(ds, matchMAC(d, mac))
+		}
+	}
+
+	if c.Sweep {
+		ds = append(ds, matchMAC(c.SubnetSweep(), mac))
+	}
+
+	doxies, err := FirstOf(ds...).Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return doxies[0], nil
+}
+
+// matchMAC returns a Discoverer which runs d and returns only the scanner with
+// the MAC address, failing with ErrDoxieNotFound if d did not find it.
+func matchMAC(d Discoverer, mac string) Discoverer {
+	return namedDiscoverer{discovererName(d), func(ctx context.Context) ([]*Doxie, error) {
+		doxies, err := d.Discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dox := range doxies {
+			if dox.MAC == mac {
+				return []*Doxie{dox}, nil
+			}
+		}
+
+		return nil, ErrDoxieNotFound
+	}}
+}
+
+// ssdpFind returns a Discoverer which sends an SSDP search and says hello to
+// each responder as it answers, ending the search as soon as the scanner with
+// the MAC address is found rather than waiting out the search window.
+func (c *Config) ssdpFind(mac string) Discoverer {
+	return namedDiscoverer{"SSDP", func(ctx context.Context) ([]*Doxie, error) {
+		searchCtx, cancel := context.WithTimeout(ctx, c.searchWindow())
+		defer cancel()
+
+		found := make(chan *Doxie, 1)
+		seen := make(map[string]bool)
+
+		var wg sync.WaitGroup
+
+		c.ssdpSearch(searchCtx, func(r *ssdpResponse) bool {
+			base := r.baseURL(c.port())
+			if seen[base] {
+				return true
+			}
+			seen[base] = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dox, err := c.helloResponder(ctx, r)
+				if err != nil || dox.MAC != mac {
+					return
+				}
+				select {
+				case found <- dox:
+					cancel()
+				default:
+				}
+			}()
+			return true
+		})
+		wg.Wait()
+
+		select {
+		case dox := <-found:
+			return []*Doxie{dox}, nil
+		default:
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, ErrDoxieNotFound
+	}}
+}
+
+// options the options applied to every Doxie found using c.
+func (c *Config) options() []Option {
+	if !c.Rediscover {
+		return c.Options
+	}
+	opts := make([]Option, 0, len(c.Options)+1)
+	opts = append(opts, c.Options...)
+	return append(opts, WithRediscovery(c))
+}
+
+// baseURL the URL of the scanner API.
+func (d *Doxie) baseURL() string {
+	if d.rediscovery == nil {
+		return d.URL
+	}
+
+	d.rediscovery.mu.Lock()
+	defer d.rediscovery.mu.Unlock()
+
+	return d.URL
+}
+
+// shouldRediscover reports whether err means the scanner could not be reached
+// and should be searched for again.
+func (d *Doxie) shouldRediscover(ctx context.Context, err error) bool {
+	var netErr *NetError
+	return d.rediscovery != nil && d.MAC != "" && ctx.Err() == nil && errors.As(err, &netErr)
+}
+
+// rediscover searches for the scanner by MAC address and updates its URL. base
+// is the URL which could not be reached, if another request has already moved
+// the scanner to a new URL there is nothing to do.
+func (d *Doxie) rediscover(ctx context.Context, base string) error {
+	d.rediscovery.mu.Lock()
+	defer d.rediscovery.mu.Unlock()
+
+	if d.URL != base {
+		return nil
+	}
+
+	dox, err := d.rediscovery.config.Find(ctx, d.MAC)
+	if err != nil {
+		return err
+	}
+
+	d.URL = dox.URL
+	d.IP = dox.IP
+	d.Mode = dox.Mode
+	d.Network = dox.Network
+	d.Interface = dox.Interface
+
+	return nil
+}
@@ -0,0 +1,432 @@
+package doxiego
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSSDPAddr the SSDP multicast group scanners are searched for on
+	DefaultSSDPAddr = "239.255.255.250:1900"
+	// DefaultSSDPAddr6 the IPv6 link-local SSDP multicast group scanners are
+	// searched for on
+	DefaultSSDPAddr6 = "[ff02::c]:1900"
+	// ssdpSearchTarget the SSDP search target advertised by Doxie scanners
+	ssdpSearchTarget = "urn:schemas-getdoxie-com:device:Scanner:1"
+	// ssdpDiscover the SSDP search request for Doxie scanners
+	ssdpDiscover = "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: " + ssdpSearchTarget + "\r\n\r\n"
+	// ssdpDiscover6 the IPv6 SSDP search request for Doxie scanners
+	ssdpDiscover6 = "M-SEARCH * HTTP/1.1\r\nHOST: [FF02::C]:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: " + ssdpSearchTarget + "\r\n\r\n"
+)
+
+// DiscoverAll searches the network for every scanner which answers an SSDP
+// search within window, and returns them de-duplicated by MAC address. It
+// returns ErrDoxieNotFound if no scanner answered.
+func DiscoverAll(ctx context.Context, window time.Duration) ([]*Doxie, error) {
+	return DefaultConfig().DiscoverAll(ctx, window)
+}
+
+// DiscoverAll is like the package level DiscoverAll but uses the settings in
+// c.
+func (c *Config) DiscoverAll(ctx context.Context, window time.Duration) ([]*Doxie, error) {
+	searchCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	var responses []*ssdpResponse
+	seen := make(map[string]bool)
+
+	err := c.ssdpSearch(searchCtx, func(r *ssdpResponse) bool {
+		base := r.baseURL(c.port())
+		if !seen[base] {
+			seen[base] = true
+			responses = append(responses, r)
+		}
+		return true
+	})
+
+	// the search always ends with an error, which is only a failure if it
+	// ended before the window elapsed.
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	} else if searchCtx.Err() == nil {
+		return nil, err
+	}
+
+	found := make([]*Doxie, len(responses))
+
+	var wg sync.WaitGroup
+	for idx, r := range responses {
+		wg.Add(1)
+		go func(idx int, r *ssdpResponse) {
+			defer wg.Done()
+			dox, err := c.helloResponder(ctx, r)
+			if err == nil {
+				found[idx] = dox
+			}
+		}(idx, r)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	doxies := uniqueByMAC(found)
+
+	if len(doxies) == 0 {
+		return nil, ErrDoxieNotFound
+	}
+
+	if c.Cache != nil {
+		c.Cache.remember(doxies...)
+	}
+
+	return doxies, nil
+}
+
+// ssdpResponse a parsed SSDP search response or NOTIFY announcement.
+type ssdpResponse struct {
+	// Location advertised by the scanner
+	Location string
+	// USN unique service name of the scanner
+	USN string
+	// ST search target, or NT notification type, of the scanner
+	ST string
+	// Server product string of the scanner
+	Server string
+	// MaxAge time the advertisement is valid for, from CACHE-CONTROL
+	MaxAge time.Duration
+	// Addr the datagram was received from
+	Addr *net.UDPAddr
+	// Interface the datagram was received on, empty if not known
+	Interface string
+}
+
+// errSSDPResponse the datagram is not an SSDP response from a Doxie scanner.
+var errSSDPResponse = errors.New("doxie: not a Doxie SSDP response")
+
+// ErrNoInterface none of the selected network interfaces can send an SSDP
+// search
+var ErrNoInterface = errors.New("doxie: no network interface to search on")
+
+// parseSSDPResponse parses the SSDP search response in data, sent from addr.
+// Responses which are not from a Doxie scanner, or whose location does not
+// point back at addr, are rejected.
+func parseSSDPResponse(data []byte, addr *net.UDPAddr) (*ssdpResponse, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errSSDPResponse
+	}
+
+	return newSSDPResponse(resp.Header, resp.Header.Get("ST"), addr)
+}
+
+// newSSDPResponse validates the SSDP headers h, advertising the search target
+// or notification type st, sent from addr.
+func newSSDPResponse(h http.Header, st string, addr *net.UDPAddr) (*ssdpResponse, error) {
+	if st != ssdpSearchTarget {
+		return nil, errSSDPResponse
+	}
+
+	r := &ssdpResponse{
+		Location: h.Get("Location"),
+		USN:      h.Get("USN"),
+		ST:       st,
+		Server:   h.Get("Server"),
+		Addr:     addr,
+	}
+
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(strings.ToLower(directive), "max-age=") {
+			if age, err := strconv.Atoi(directive[len("max-age="):]); err == nil {
+				r.MaxAge = time.Duration(age) * time.Second
+			}
+		}
+	}
+
+	if r.Location != "" {
+		u, err := url.Parse(r.Location)
+		if err != nil {
+			return nil, err
+		}
+		// a responder may only advertise a location on its own address, a
+		// link-local LOCATION may carry a zone which is not part of the address.
+		host := u.Hostname()
+		if i := strings.IndexByte(host, '%'); i >= 0 {
+			host = host[:i]
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.Equal(addr.IP) {
+			return nil, errSSDPResponse
+		}
+	}
+
+	return r, nil
+}
+
+// baseURL the URL of the scanner API, at the advertised location if there is
+// one, otherwise at the responders address on port.
+func (r *ssdpResponse) baseURL(port int) string {
+	if r.Location != "" {
+		if u, err := url.Parse(r.Location); err == nil && u.Port() != "" {
+			// the host was checked against the sender, and the zone the
+			// datagram arrived on is the one which reaches the scanner
+			return u.Scheme + "://" + net.JoinHostPort(r.zonedHost(), u.Port()) + "/"
+		}
+	}
+
+	return "http://" + net.JoinHostPort(r.zonedHost(), strconv.Itoa(port)) + "/"
+}
+
+// zonedHost the address the datagram was received from, with its zone escaped
+// for use in a URL.
+func (r *ssdpResponse) zonedHost() string {
+	host := r.Addr.IP.String()
+	if r.Addr.Zone != "" {
+		host += "%25" + r.Addr.Zone
+	}
+	return host
+}
+
+// helloResponder requests hello.json from the scanner which sent r.
+func (c *Config) helloResponder(ctx context.Context, r *ssdpResponse) (*Doxie, error) {
+	dox, err := hello(ctx, r.baseURL(c.port()), c.options()...)
+	if err != nil {
+		return nil, err
+	}
+
+	dox.Interface = r.Interface
+
+	return dox, nil
+}
+
+// ssdpConn a socket SSDP searches are sent from.
+type ssdpConn struct {
+	conn    *net.UDPConn
+	dst     *net.UDPAddr
+	request string
+	iface   string
+}
+
+// ssdpConns opens the sockets SSDP searches are sent from. With no interfaces
+// selected and IPv6 disabled a single IPv4 socket is used, and the kernel picks
+// the interface. Otherwise there is an IPv4 socket bound to the address of each
+// selected interface and, if enabled, an IPv6 socket scoped to it.
+func (c *Config) ssdpConns() ([]*ssdpConn, error) {
+	if len(c.Interfaces) == 0 && !c.AllInterfaces && !c.IPv6 {
+		dst, err := net.ResolveUDPAddr("udp4", c.ssdpAddr())
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := net.ListenUDP("udp4", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*ssdpConn{{conn: conn, dst: dst, request: ssdpDiscover}}, nil
+	}
+
+	ifaces, err := c.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var conns []*ssdpConn
+
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		var ip4 net.IP
+		var has6 bool
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				if ipNet.IP.To4() != nil {
+					if ip4 == nil {
+						ip4 = ipNet.IP.To4()
+					}
+				} else {
+					has6 = true
+				}
+			}
+		}
+
+		if ip4 != nil {
+			dst, err := net.ResolveUDPAddr("udp4", c.ssdpAddr())
+			if err != nil {
+				return nil, err
+			}
+
+			// binding the source address alone only picks the interface
+			// multicast leaves through on Linux, so set it on the socket too
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ip4})
+			if err == nil && dst.IP.IsMulticast() {
+				if err = setMulticastInterface(conn, ip4); err != nil {
+					conn.Close()
+				}
+			}
+			if err == nil {
+				conns = append(conns, &ssdpConn{conn: conn, dst: dst, request: ssdpDiscover, iface: iface.Name})
+			}
+		}
+
+		if c.IPv6 && has6 {
+			dst, err := net.ResolveUDPAddr("udp6", c.ssdpAddr6())
+			if err != nil {
+				return nil, err
+			}
+
+			if dst.IP.IsLinkLocalMulticast() {
+				dst.Zone = iface.Name
+			}
+
+			conn, err := net.ListenUDP("udp6", nil)
+			if err == nil {
+				conns = append(conns, &ssdpConn{conn: conn, dst: dst, request: ssdpDiscover6, iface: iface.Name})
+			}
+		}
+	}
+
+	if len(conns) == 0 {
+		return nil, ErrNoInterface
+	}
+
+	return conns, nil
+}
+
+// interfaces the network interfaces named in Config.Interfaces, or every up
+// multicast interface other than loopback.
+func (c *Config) interfaces() ([]net.Interface, error) {
+	if len(c.Interfaces) > 0 {
+		ifaces := make([]net.Interface, 0, len(c.Interfaces))
+		for _, name := range c.Interfaces {
+			iface, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, err
+			}
+			ifaces = append(ifaces, *iface)
+		}
+		return ifaces, nil
+	}
+
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaces []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp != 0 &&
+			iface.Flags&net.FlagMulticast != 0 &&
+			iface.Flags&net.FlagLoopback == 0 {
+			ifaces = append(ifaces, iface)
+		}
+	}
+
+	return ifaces, nil
+}
+
+// ssdpSearch sends an SSDP search for Doxie scanners and calls found with each
+// valid response, until found returns false or ctx is done. The search only
+// ends without an error if found returns false.
+func (c *Config) ssdpSearch(ctx context.Context, found func(r *ssdpResponse) bool) error {
+	conns, err := c.ssdpConns()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make(chan *ssdpResponse)
+	errs := make(chan error, len(conns))
+
+	for _, sc := range conns {
+		defer sc.conn.Close()
+
+		stop := watchConn(ctx, sc.conn)
+		defer stop()
+
+		if _, err := sc.conn.WriteTo([]byte(sc.request), sc.dst); err != nil {
+			errs <- err
+			continue
+		}
+
+		go func(sc *ssdpConn) {
+			buffer := make([]byte, 2048)
+
+			for {
+				n, addr, err := sc.conn.ReadFromUDP(buffer)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// ignore anything which is not a Doxie answering our search
+				r, err := parseSSDPResponse(buffer[:n], addr)
+				if err != nil {
+					continue
+				}
+				r.Interface = sc.iface
+
+				select {
+				case responses <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(sc)
+	}
+
+	// the search fails once every socket has failed.
+	for failed := 0; ; {
+		select {
+		case r := <-responses:
+			if !found(r) {
+				return nil
+			}
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if failed++; failed == len(conns) {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ssdpAddr the address SSDP searches are sent to.
+func (c *Config) ssdpAddr() string {
+	if c.SSDPAddr != "" {
+		return c.SSDPAddr
+	}
+	return DefaultSSDPAddr
+}
+
+// ssdpAddr6 the address IPv6 SSDP searches are sent to.
+func (c *Config) ssdpAddr6() string {
+	if c.SSDPAddr6 != "" {
+		return c.SSDPAddr6
+	}
+	return DefaultSSDPAddr6
+}
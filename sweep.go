@@ -0,0 +1,185 @@
+package doxiego
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSweepConcurrency number of hosts probed at once by a subnet sweep
+	DefaultSweepConcurrency = 64
+	// DefaultSweepTimeout time a host has to answer a subnet sweep probe
+	DefaultSweepTimeout = 500 * time.Millisecond
+	// maxSweepPrefix the largest local subnet swept in full, larger subnets
+	// are narrowed to the /24 around the interface address
+	maxSweepPrefix = 22
+)
+
+// SubnetSweep returns a Discoverer which probes hello.json on Config.Port of
+// every address in subnets, and returns the hosts which answer as a Doxie. If
+// no subnets are given the IPv4 subnets of the local interfaces are swept. It
+// finds scanners on networks which filter SSDP.
+func (c *Config) SubnetSweep(subnets ...*net.IPNet) Discoverer {
+	return namedDiscoverer{"subnet sweep", func(ctx context.Context) ([]*Doxie, error) {
+		sweep := subnets
+		if len(sweep) == 0 {
+			local, err := localSubnets()
+			if err != nil {
+				return nil, err
+			}
+			sweep = local
+		}
+
+		hosts := make(chan net.IP)
+		found := make(chan *Doxie)
+
+		var wg sync.WaitGroup
+		for i := 0; i < c.sweepConcurrency(); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ip := range hosts {
+					if dox := c.probe(ctx, ip); dox != nil {
+						found <- dox
+					}
+				}
+			}()
+		}
+
+		go func() {
+			defer close(hosts)
+			for _, subnet := range sweep {
+				for _, ip := range subnetHosts(subnet) {
+					select {
+					case hosts <- ip:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+
+		go func() {
+			wg.Wait()
+			close(found)
+		}()
+
+		var doxies []*Doxie
+		for dox := range found {
+			doxies = append(doxies, dox)
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		doxies = uniqueByMAC(doxies)
+		if len(doxies) == 0 {
+			return nil, ErrDoxieNotFound
+		}
+
+		return doxies, nil
+	}}
+}
+
+// probe returns the scanner at ip, or nil if there is no Doxie there.
+func (c *Config) probe(ctx context.Context, ip net.IP) *Doxie {
+	ctx, cancel := context.WithTimeout(ctx, c.sweepTimeout())
+	defer cancel()
+
+	dox, err := hello(ctx, c.baseURL(ip.String()), c.options()...)
+	if err != nil || !strings.HasPrefix(dox.Model, "DX") {
+		return nil
+	}
+
+	return dox
+}
+
+// localSubnets the IPv4 subnets of the up, non-loopback interfaces.
+func localSubnets() ([]*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets []*net.IPNet
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+
+			ones, _ := ipNet.Mask.Size()
+			mask := ipNet.Mask
+			if ones < maxSweepPrefix {
+				mask = net.CIDRMask(24, 32)
+			}
+
+			subnets = append(subnets, &net.IPNet{IP: ipNet.IP.To4().Mask(mask), Mask: mask})
+		}
+	}
+
+	return subnets, nil
+}
+
+// subnetHosts the host addresses of the IPv4 subnet, excluding the network
+// and broadcast addresses of subnets larger than /31.
+func subnetHosts(subnet *net.IPNet) []net.IP {
+	ip := subnet.IP.To4()
+	if ip == nil {
+		return nil
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits != 32 {
+		return nil
+	}
+
+	first := binary.BigEndian.Uint32(ip.Mask(subnet.Mask))
+	size := uint32(1) << uint(32-ones)
+
+	start, end := first, first+size-1
+	if ones < 31 {
+		start, end = first+1, first+size-2
+	}
+
+	var hosts []net.IP
+	for n := start; n <= end && n >= start; n++ {
+		host := make(net.IP, 4)
+		binary.BigEndian.PutUint32(host, n)
+		hosts = append(hosts, host)
+	}
+
+	return hosts
+}
+
+// sweepConcurrency number of hosts probed at once by a subnet sweep.
+func (c *Config) sweepConcurrency() int {
+	if c.SweepConcurrency > 0 {
+		return c.SweepConcurrency
+	}
+	return DefaultSweepConcurrency
+}
+
+// sweepTimeout time a host has to answer a subnet sweep probe.
+func (c *Config) sweepTimeout() time.Duration {
+	if c.SweepTimeout > 0 {
+		return c.SweepTimeout
+	}
+	return DefaultSweepTimeout
+}